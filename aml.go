@@ -1,23 +1,30 @@
 package idanalyzer
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"strings"
+	"time"
+	"unicode"
 )
 
 type AMLAPI struct {
-	apiKey        string
-	apiEndpoint   string
+	apiClient
 	amlDatabases  string
 	amlEntityType string
+	amlStrict     bool
+	maxResults    uint
 }
 
+// The AML API has no paging parameters, and returns every match it finds in a single response
 type AMLResponse struct {
-	Items []AMLResponseItem `json:"items"`
+	Error       *APIError         `json:"error"`
+	Items       []AMLResponseItem `json:"items"`
+	Total       uint              `json:"-"` // Number of items the API returned, before any SetMaxResults limit
+	Truncated   bool              `json:"-"` // Whether Items was cut down to the SetMaxResults limit
+	RawResponse []byte            `json:"-"` // Copy of the exact JSON returned by the API
+	RequestID   string            `json:"-"` // Request ID from the API server's response headers, for support tickets; empty if the server sent none
 }
 
 type AMLResponseItem struct {
@@ -39,6 +46,45 @@ type AMLResponseItem struct {
 	Time           string                          `json:"time,omitempty"`
 	Source         []string                        `json:"source,omitempty"`
 	Database       string                          `json:"database,omitempty"`
+	MatchScore     float32                         `json:"-"` // Relevance to the search terms from 0 to 1, computed by AMLAPI searches only
+}
+
+// Items whose MatchScore is at least threshold, in their original order
+//
+// The AML API returns no relevance score of its own, so MatchScore is computed by the SDK from the search terms:
+// each term given (name or document number, plus DOB and country when set) scores from 0 to 1, and the scores are averaged
+// Terms the item has no data for (e.g. no DOB or no ISO country code for nationality) are left out, not counted as mismatches
+// Names score by the share of search words found in the entity's full name, any alias or its name parts, ignoring case,
+// punctuation and diacritics; a DOB matching the year only scores 0.5
+func (r AMLResponse) AboveThreshold(threshold float32) []AMLResponseItem {
+	var items []AMLResponseItem
+	for _, item := range r.Items {
+		if item.MatchScore >= threshold {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// Items keyed by the code of the source database that matched them (see AMLDatabases), each list in its original order
+// Items without a database code are grouped under ""
+func (r AMLResponse) GroupByDatabase() map[string][]AMLResponseItem {
+	groups := map[string][]AMLResponseItem{}
+	for _, item := range r.Items {
+		groups[item.Database] = append(groups[item.Database], item)
+	}
+
+	return groups
+}
+
+// One person or company to screen with SearchBatch
+// Name and DocumentNumber may both be set to search by both at once; Country and DOB are optional
+type AMLQuery struct {
+	Name           string
+	DocumentNumber string
+	Country        string
+	DOB            string
 }
 
 type AMLResponseItemDocumentNumber struct {
@@ -49,20 +95,85 @@ type AMLResponseItemDocumentNumber struct {
 	Summary     string `json:"summary,omitempty"`
 }
 
+// Known AML source database codes, for use with SetAMLDatabases
+// See the AML API Overview for descriptions of each database
+var AMLDatabases = []string{
+	"au_dfat",
+	"ca_dfatd",
+	"ch_seco",
+	"eu_cor",
+	"eu_fsf",
+	"eu_meps",
+	"fr_tresor_gels_avoir",
+	"gb_hmt",
+	"global_politicians",
+	"interpol_red",
+	"ua_sfms",
+	"un_sc",
+	"us_ofac",
+}
+
 // Initialize AML API with an API key and region (US (default), EU)
-func NewAMLAPI(apiKey, region string) (AMLAPI, error) {
+func NewAMLAPI(apiKey, region string, opts ...AMLOption) (AMLAPI, error) {
 	if apiKey == "" {
 		return AMLAPI{}, errors.New("please provide an API key")
 	}
 
-	return AMLAPI{
-		apiKey:      apiKey,
-		apiEndpoint: endpointFromRegion(region, "aml"),
-	}, nil
+	client, err := newAPIClient(apiKey, region, "aml")
+	if err != nil {
+		return AMLAPI{}, err
+	}
+
+	a := AMLAPI{
+		apiClient: client,
+	}
+
+	for _, opt := range opts {
+		if err := opt.applyAML(&a); err != nil {
+			return AMLAPI{}, err
+		}
+	}
+
+	return a, nil
+}
+
+// OPTIONS
+
+// Configures an AMLAPI at construction time
+// Any ClientOption is also an AMLOption
+type AMLOption interface {
+	applyAML(a *AMLAPI) error
+}
+
+type amlOption func(a *AMLAPI) error
+
+func (o amlOption) applyAML(a *AMLAPI) error {
+	return o(a)
+}
+
+// Limit the number of items kept in each response at construction time, as with SetMaxResults
+func WithMaxResults(max uint) AMLOption {
+	return amlOption(func(a *AMLAPI) error {
+		a.SetMaxResults(max)
+
+		return nil
+	})
 }
 
 // SETTERS
 
+// Set a default timeout for API requests, applied whenever the request context has no deadline of its own
+// Set to 0 to disable the default timeout
+func (a *AMLAPI) SetTimeout(timeout time.Duration) {
+	a.timeout = timeout
+}
+
+// Send requests to endpoint verbatim, instead of the endpoint chosen by region, e.g. a mock server or on-premise deployment
+// Only http and https URLs are accepted, and any trailing slash is removed
+func (a *AMLAPI) SetEndpoint(endpoint string) error {
+	return a.setEndpoint(endpoint)
+}
+
 // Specify the source databases to perform AML search
 // If left blank, all source databases will be checked
 // Separate each database code with comma, for example: un_sc,us_ofac
@@ -76,6 +187,42 @@ func (a *AMLAPI) SetAMLDatabase(databases string) {
 	a.amlDatabases = databases
 }
 
+// Keep at most max items in each response, setting Truncated when more were returned; 0 (default) keeps every item
+// Total always reports how many items the API returned, so callers can tell when a search needs narrowing
+func (a *AMLAPI) SetMaxResults(max uint) {
+	a.maxResults = max
+}
+
+// Specify the source databases to perform AML search, checking each code against AMLDatabases
+// Unknown codes are all listed in the returned error and nothing is changed; pass no codes to check all databases
+// Use SetAMLDatabase to pass codes for databases added to the API since this SDK was released
+func (a *AMLAPI) SetAMLDatabases(codes ...string) error {
+	known := map[string]bool{}
+	for _, code := range AMLDatabases {
+		known[code] = true
+	}
+
+	var unknown []string
+	for _, code := range codes {
+		if !known[code] {
+			unknown = append(unknown, code)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown AML database codes: %s", strings.Join(unknown, ", "))
+	}
+
+	a.amlDatabases = strings.Join(codes, ",")
+
+	return nil
+}
+
+// By default, entities with identical name or document number will be considered a match even though their birthday or nationality may be unknown
+// Enable this parameter to reduce false-positives by only matching entities with exact same nationality and birthday
+func (a *AMLAPI) EnableAMLStrictMatch(enabled bool) {
+	a.amlStrict = enabled
+}
+
 // Return only entities with specified entity type
 // Leave blank to return both person and legal entity.
 func (a *AMLAPI) SetEntityType(entityType string) error {
@@ -91,7 +238,12 @@ func (a *AMLAPI) SetEntityType(entityType string) error {
 
 // Search AML Database using a person or company's name or alias
 func (a *AMLAPI) SearchByName(name, country, dob string) (AMLResponse, error) {
-	return a.callAPI(amlRequest{
+	return a.SearchByNameContext(context.Background(), name, country, dob)
+}
+
+// Search AML Database using a person or company's name or alias, bounded by ctx
+func (a *AMLAPI) SearchByNameContext(ctx context.Context, name, country, dob string) (AMLResponse, error) {
+	return a.callAPI(ctx, amlRequest{
 		Name:    name,
 		Country: country,
 		DOB:     dob,
@@ -100,13 +252,41 @@ func (a *AMLAPI) SearchByName(name, country, dob string) (AMLResponse, error) {
 
 // Search AML Database using a document number (Passport, ID Card or any identification documents)
 func (a *AMLAPI) SearchByIDNumber(documentNumber, country, dob string) (AMLResponse, error) {
-	return a.callAPI(amlRequest{
+	return a.SearchByIDNumberContext(context.Background(), documentNumber, country, dob)
+}
+
+// Search AML Database using a document number, bounded by ctx
+func (a *AMLAPI) SearchByIDNumberContext(ctx context.Context, documentNumber, country, dob string) (AMLResponse, error) {
+	return a.callAPI(ctx, amlRequest{
 		DocumentNumber: documentNumber,
 		Country:        country,
 		DOB:            dob,
 	})
 }
 
+// Screen many people or companies with up to concurrency searches in flight at once, returning results in the same order as queries
+// One failed search doesn't stop the others: failures are collected in a *BatchError keyed by query index
+// Searches go through any rate limit set with WithRateLimit, and searches not yet started when ctx is done fail with ctx.Err()
+func (a *AMLAPI) SearchBatch(ctx context.Context, queries []AMLQuery, concurrency int) ([]AMLResponse, error) {
+	results := make([]AMLResponse, len(queries))
+	err := runBatch(ctx, len(queries), concurrency, func(index int) (err error) {
+		query := queries[index]
+		if query.Name == "" && query.DocumentNumber == "" {
+			return errors.New("name or document number required")
+		}
+
+		results[index], err = a.callAPI(ctx, amlRequest{
+			Name:           query.Name,
+			DocumentNumber: query.DocumentNumber,
+			Country:        query.Country,
+			DOB:            query.DOB,
+		})
+		return err
+	})
+
+	return results, err
+}
+
 // PRIVATE
 
 type amlRequest struct {
@@ -118,24 +298,192 @@ type amlRequest struct {
 	DocumentNumber string `json:"documentnumber"`
 	Country        string `json:"country"`
 	DOB            string `json:"dob"`
+	StrictMatch    bool   `json:"strict_match"`
 }
 
-func (a *AMLAPI) callAPI(request amlRequest) (AMLResponse, error) {
+func (a *AMLAPI) callAPI(ctx context.Context, request amlRequest) (AMLResponse, error) {
 	request.ApiKey = a.apiKey
 	request.Database = a.amlDatabases
 	request.Entity = a.amlEntityType
-	request.Client = "go-sdk"
+	request.StrictMatch = a.amlStrict
+	request.Client = a.client()
+
+	ctx, cancel := withDefaultTimeout(ctx, a.timeout)
+	defer cancel()
+
+	var result AMLResponse
+	raw, err := a.doJSON(ctx, a.apiEndpoint, request, &result)
+	result.RawResponse = raw
+	if err != nil {
+		return result, err
+	}
+	if result.Error != nil && result.Error.Message != "" {
+		return result, result.Error
+	}
+
+	for i := range result.Items {
+		result.Items[i].MatchScore = amlMatchScore(result.Items[i], request)
+	}
+
+	result.Total = uint(len(result.Items))
+	if a.maxResults > 0 && result.Total > a.maxResults {
+		result.Items = result.Items[:a.maxResults]
+		result.Truncated = true
+	}
+
+	return result, nil
+}
 
-	body, _ := json.Marshal(request)
+// Score item against the search terms in request; terms the item has no data for are left out rather than scored as mismatches
+// An item with no data for any term scores 1, since the API returned it as a match and nothing contradicts that
+func amlMatchScore(item AMLResponseItem, request amlRequest) float32 {
+	var total float32
+	var terms int
 
-	if response, err := http.Post(a.apiEndpoint, "application/json", bytes.NewBuffer(body)); err != nil {
-		return AMLResponse{}, fmt.Errorf("failed to connect to API server: %s", err.Error())
-	} else {
-		var result AMLResponse
+	if query := amlNameTokens(request.Name); len(query) > 0 {
+		names := append(append([]string{}, item.FullName...), item.Alias...)
+		names = append(names, strings.Join(append(append(append([]string{}, item.FirstName...), item.MiddleName...), item.LastName...), " "))
 
-		body, _ := io.ReadAll(response.Body)
-		json.Unmarshal(body, &result)
+		var best float32
+		var compared bool
+		for _, name := range names {
+			words := map[string]bool{}
+			for _, word := range amlNameTokens(name) {
+				words[word] = true
+			}
+			if len(words) == 0 {
+				continue
+			}
+			compared = true
 
-		return result, nil
+			found := 0
+			for _, word := range query {
+				if words[word] {
+					found++
+				}
+			}
+			if score := float32(found) / float32(len(query)); score > best {
+				best = score
+			}
+		}
+		if compared {
+			terms++
+			total += best
+		}
 	}
+
+	if request.DocumentNumber != "" && len(item.DocumentNumber) > 0 {
+		terms++
+		for _, number := range item.DocumentNumber {
+			if amlDigitsAndLetters(number.ID) == amlDigitsAndLetters(request.DocumentNumber) {
+				total++
+				break
+			}
+		}
+	}
+
+	if request.DOB != "" && len(item.DOB) > 0 {
+		terms++
+		query := amlDigitsAndLetters(request.DOB)
+		var best float32
+		for _, dob := range item.DOB {
+			dob = amlDigitsAndLetters(dob)
+			if dob == query {
+				best = 1
+				break
+			} else if len(dob) == 4 && strings.HasPrefix(query, dob) {
+				best = 0.5
+			}
+		}
+		total += best
+	}
+
+	if request.Country != "" {
+		var codes []string
+		for _, nationality := range item.Nationality {
+			if nationality = strings.TrimSpace(nationality); len(nationality) == 2 {
+				codes = append(codes, nationality)
+			}
+		}
+		if len(codes) > 0 {
+			terms++
+			for _, code := range codes {
+				if strings.EqualFold(code, request.Country) {
+					total++
+					break
+				}
+			}
+		}
+	}
+
+	if terms == 0 {
+		return 1
+	}
+
+	return total / float32(terms)
+}
+
+// Lowercase words of a name with punctuation removed and Latin diacritics folded, so "SMITH, José" gives "smith", "jose"
+func amlNameTokens(name string) []string {
+	var folded strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if base, ok := amlFoldedLetters[r]; ok {
+			folded.WriteString(base)
+		} else {
+			folded.WriteRune(r)
+		}
+	}
+
+	return strings.FieldsFunc(folded.String(), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Lowercase Latin letters with diacritics, mapped to the plain letters they are usually written as
+var amlFoldedLetters = func() map[rune]string {
+	letters := map[string]string{
+		"a":  "àáâãäåāăą",
+		"ae": "æ",
+		"c":  "çćĉċč",
+		"d":  "ďđð",
+		"e":  "èéêëēĕėęě",
+		"g":  "ĝğġģ",
+		"h":  "ĥħ",
+		"i":  "ìíîïĩīĭįı",
+		"ij": "ĳ",
+		"j":  "ĵ",
+		"k":  "ķ",
+		"l":  "ĺļľŀł",
+		"n":  "ñńņň",
+		"o":  "òóôõöøōŏő",
+		"oe": "œ",
+		"r":  "ŕŗř",
+		"s":  "śŝşšș",
+		"ss": "ß",
+		"t":  "ţťŧț",
+		"th": "þ",
+		"u":  "ùúûüũūŭůűų",
+		"w":  "ŵ",
+		"y":  "ýÿŷ",
+		"z":  "źżž",
+	}
+
+	folded := map[rune]string{}
+	for base, accented := range letters {
+		for _, r := range accented {
+			folded[r] = base
+		}
+	}
+
+	return folded
+}()
+
+// Strip separators so that e.g. "1980/01/02" and "1980-01-02" compare equal
+func amlDigitsAndLetters(value string) string {
+	return strings.ToLower(strings.Map(func(r rune) rune {
+		if (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+			return r
+		}
+		return -1
+	}, value))
 }
@@ -0,0 +1,93 @@
+package idanalyzer
+
+import "testing"
+
+func TestAMLMatchScore(t *testing.T) {
+	tests := []struct {
+		name    string
+		item    AMLResponseItem
+		request amlRequest
+		want    float32
+	}{
+		{
+			name:    "reordered name with punctuation",
+			item:    AMLResponseItem{FullName: []string{"SMITH, John"}},
+			request: amlRequest{Name: "John Smith"},
+			want:    1,
+		},
+		{
+			name:    "diacritics folded",
+			item:    AMLResponseItem{FullName: []string{"José Müller-Łukasz"}},
+			request: amlRequest{Name: "jose muller lukasz"},
+			want:    1,
+		},
+		{
+			name:    "alias match",
+			item:    AMLResponseItem{FullName: []string{"Jonathan Smith"}, Alias: []string{"John Smith"}},
+			request: amlRequest{Name: "John Smith"},
+			want:    1,
+		},
+		{
+			name:    "name parts match",
+			item:    AMLResponseItem{FirstName: []string{"John"}, LastName: []string{"Smith"}},
+			request: amlRequest{Name: "Smith John"},
+			want:    1,
+		},
+		{
+			name:    "partial name",
+			item:    AMLResponseItem{FullName: []string{"John Smith"}},
+			request: amlRequest{Name: "John Doe"},
+			want:    0.5,
+		},
+		{
+			name:    "missing nationality is neutral",
+			item:    AMLResponseItem{FullName: []string{"John Smith"}},
+			request: amlRequest{Name: "John Smith", Country: "US"},
+			want:    1,
+		},
+		{
+			name:    "unknown nationality format is neutral",
+			item:    AMLResponseItem{FullName: []string{"John Smith"}, Nationality: []string{"Unknown"}},
+			request: amlRequest{Name: "John Smith", Country: "US"},
+			want:    1,
+		},
+		{
+			name:    "different nationality",
+			item:    AMLResponseItem{FullName: []string{"John Smith"}, Nationality: []string{"GB"}},
+			request: amlRequest{Name: "John Smith", Country: "US"},
+			want:    0.5,
+		},
+		{
+			name:    "missing DOB is neutral",
+			item:    AMLResponseItem{FullName: []string{"John Smith"}},
+			request: amlRequest{Name: "John Smith", DOB: "1980/01/02"},
+			want:    1,
+		},
+		{
+			name:    "DOB year only",
+			item:    AMLResponseItem{FullName: []string{"John Smith"}, DOB: []string{"1980"}},
+			request: amlRequest{Name: "John Smith", DOB: "1980-01-02"},
+			want:    0.75,
+		},
+		{
+			name:    "document number ignores separators",
+			item:    AMLResponseItem{DocumentNumber: []AMLResponseItemDocumentNumber{{ID: "X12-345"}}},
+			request: amlRequest{DocumentNumber: "x12345"},
+			want:    1,
+		},
+		{
+			name:    "no comparable data",
+			item:    AMLResponseItem{Entity: "person"},
+			request: amlRequest{Name: "John Smith", Country: "US", DOB: "1980/01/02"},
+			want:    1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := amlMatchScore(test.item, test.request); got != test.want {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
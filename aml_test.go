@@ -0,0 +1,116 @@
+package idanalyzer_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/danhunsaker/idanalyzer-go-sdk"
+	"github.com/danhunsaker/idanalyzer-go-sdk/idanalyzertest"
+)
+
+func newTestAML(t *testing.T, handler http.Handler) idanalyzer.AMLAPI {
+	t.Helper()
+
+	server := idanalyzertest.NewServer(map[string]http.Handler{idanalyzertest.PathAML: handler})
+	t.Cleanup(server.Close)
+
+	aml, err := idanalyzer.NewAMLAPI("key", "", server.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return aml
+}
+
+func TestAMLSearchReturnsAPIError(t *testing.T) {
+	aml := newTestAML(t, idanalyzertest.Error(idanalyzertest.ErrCountryRestricted()))
+
+	response, err := aml.SearchByName("JANE SAMPLE", "", "")
+	var apiError *idanalyzer.APIError
+	if !errors.As(err, &apiError) {
+		t.Fatalf("expected *APIError, got %v", err)
+	}
+	if apiError.Code != idanalyzer.ErrCodeCountryRestricted {
+		t.Errorf("expected code %d, got %d", idanalyzer.ErrCodeCountryRestricted, apiError.Code)
+	}
+	if len(response.Items) != 0 {
+		t.Errorf("expected no items, got %d", len(response.Items))
+	}
+}
+
+func TestAMLSearchSuccess(t *testing.T) {
+	aml := newTestAML(t, idanalyzertest.JSON(idanalyzertest.AMLSuccess()))
+
+	response, err := aml.SearchByName("JANE SAMPLE", "US", "1990-01-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Items) != 1 || response.Items[0].MatchScore != 1 {
+		t.Errorf("expected one exact match, got %+v", response.Items)
+	}
+}
+
+func TestAMLSearchBatch(t *testing.T) {
+	aml := newTestAML(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Name string `json:"name"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		idanalyzertest.JSON(idanalyzer.AMLResponse{Items: []idanalyzer.AMLResponseItem{{FullName: []string{payload.Name}}}}).ServeHTTP(w, r)
+	}))
+	queries := []idanalyzer.AMLQuery{{Name: "ONE"}, {}, {Name: "THREE"}, {Name: "FOUR"}}
+
+	results, err := aml.SearchBatch(context.Background(), queries, 3)
+	var batchError *idanalyzer.BatchError
+	if !errors.As(err, &batchError) || len(batchError.Errors) != 1 || batchError.Errors[1] == nil {
+		t.Fatalf("expected only query 1 to fail, got %v", err)
+	}
+	for index, query := range queries {
+		if query.Name != "" && (len(results[index].Items) != 1 || results[index].Items[0].FullName[0] != query.Name) {
+			t.Errorf("result %d out of order: %+v", index, results[index].Items)
+		}
+	}
+}
+
+func TestAMLStrictMatchIsSent(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		var payload map[string]interface{}
+		aml := newTestAML(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&payload)
+			idanalyzertest.JSON(idanalyzertest.AMLSuccess()).ServeHTTP(w, r)
+		}))
+		aml.EnableAMLStrictMatch(strict)
+
+		if _, err := aml.SearchByName("JANE SAMPLE", "US", ""); err != nil {
+			t.Fatal(err)
+		}
+		if payload["strict_match"] != strict {
+			t.Errorf("expected strict_match %v, got %v", strict, payload["strict_match"])
+		}
+	}
+}
+
+func TestAMLGroupByDatabase(t *testing.T) {
+	aml := newTestAML(t, idanalyzertest.JSON(idanalyzertest.AMLMultipleDatabases()))
+
+	response, err := aml.SearchByName("JANE SAMPLE", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups := response.GroupByDatabase()
+	for database, want := range map[string]int{"us_ofac": 2, "eu_fsf": 1, "": 1} {
+		if len(groups[database]) != want {
+			t.Errorf("expected %d items for database %q, got %d", want, database, len(groups[database]))
+		}
+	}
+	if len(groups) != 3 {
+		t.Errorf("expected 3 groups, got %d", len(groups))
+	}
+	if groups["us_ofac"][0].FullName[0] != "JANE SAMPLE" || groups["us_ofac"][1].FullName[0] != "JANE A SAMPLE" {
+		t.Errorf("expected us_ofac items in their original order, got %+v", groups["us_ofac"])
+	}
+}
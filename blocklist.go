@@ -0,0 +1,87 @@
+package idanalyzer
+
+import (
+	"context"
+	"time"
+)
+
+// Manages the account blocklist checked by CoreAPI.EnableBlocklistCheck
+// The blocklist is the set of vault entries marked as blocked, so documents must be in the vault (e.g. saved by a scan
+// with EnableVault) before they can be blocked; blocking and unblocking go through the Vault API
+type BlocklistAPI struct {
+	vault VaultAPI
+}
+
+// Initialize Blocklist API with an API key and region (US (default), EU)
+func NewBlocklistAPI(apiKey, region string, opts ...ClientOption) (BlocklistAPI, error) {
+	vault, err := NewVaultAPI(apiKey, region, opts...)
+	if err != nil {
+		return BlocklistAPI{}, err
+	}
+
+	return BlocklistAPI{vault: vault}, nil
+}
+
+// SETTERS
+
+// Set a default timeout for API requests, applied whenever the request context has no deadline of its own
+// Set to 0 to disable the default timeout
+func (b *BlocklistAPI) SetTimeout(timeout time.Duration) {
+	b.vault.SetTimeout(timeout)
+}
+
+// Send requests to endpoint verbatim, instead of the Vault API endpoint chosen by region
+// Only http and https URLs are accepted, and any trailing slash is removed
+func (b *BlocklistAPI) SetEndpoint(endpoint string) error {
+	return b.vault.SetEndpoint(endpoint)
+}
+
+// ACTIONS
+
+// Block the document in a vault entry, so later scans of it fail the blocklist check
+func (b *BlocklistAPI) Add(vault_id string) (VaultSuccessResponse, error) {
+	return b.AddContext(context.Background(), vault_id)
+}
+
+// Block the document in a vault entry, bounded by ctx
+func (b *BlocklistAPI) AddContext(ctx context.Context, vault_id string) (VaultSuccessResponse, error) {
+	return b.vault.UpdateFieldsContext(ctx, vault_id, map[string]interface{}{"block": "1"})
+}
+
+// Unblock the document in a vault entry; the entry itself is kept
+func (b *BlocklistAPI) Remove(vault_id string) (VaultSuccessResponse, error) {
+	return b.RemoveContext(context.Background(), vault_id)
+}
+
+// Unblock the document in a vault entry, bounded by ctx
+func (b *BlocklistAPI) RemoveContext(ctx context.Context, vault_id string) (VaultSuccessResponse, error) {
+	return b.vault.UpdateFieldsContext(ctx, vault_id, map[string]interface{}{"block": "0"})
+}
+
+// Every blocked vault entry, newest first
+func (b *BlocklistAPI) List() ([]VaultData, error) {
+	return b.ListContext(context.Background())
+}
+
+// Every blocked vault entry, newest first, bounded by ctx
+func (b *BlocklistAPI) ListContext(ctx context.Context) ([]VaultData, error) {
+	filter, err := NewVaultFilter().Equals("block", "1").Build()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := b.vault.ListAllContext(ctx, filter, "createtime", "DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	var blocked []VaultData
+	for entries.Next() {
+		blocked = append(blocked, entries.Item())
+	}
+	if err := entries.Err(); err != nil {
+		return blocked, err
+	}
+
+	return blocked, nil
+}
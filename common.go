@@ -1,11 +1,113 @@
 package idanalyzer
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Returned by batch actions when some items failed; the results for the other items are still returned
+type BatchError struct {
+	Errors map[int]error // Errors by index into the batch input
+}
+
+func (e *BatchError) Error() string {
+	indices := make([]int, 0, len(e.Errors))
+	for index := range e.Errors {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+
+	messages := make([]string, 0, len(indices))
+	for _, index := range indices {
+		messages = append(messages, fmt.Sprintf("item %d: %s", index, e.Errors[index].Error()))
+	}
+
+	return fmt.Sprintf("%d batch items failed: %s", len(indices), strings.Join(messages, "; "))
+}
+
+// Run job for every index below count, with up to concurrency jobs at once, collecting any failures in a *BatchError
+// Jobs not yet started when ctx is done fail with ctx.Err()
+func runBatch(ctx context.Context, count, concurrency int, job func(index int) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	failures := map[int]error{}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	jobs := make(chan int)
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				err := ctx.Err()
+				if err == nil {
+					err = job(index)
+				}
+				if err != nil {
+					mutex.Lock()
+					failures[index] = err
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+
+	for index := 0; index < count; index++ {
+		jobs <- index
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(failures) > 0 {
+		return &BatchError{Errors: failures}
+	}
+
+	return nil
+}
+
+// Passed to the function given to WithStrictDecoding when an API response has a field the SDK doesn't model
+type UnknownFieldError struct {
+	Endpoint string // URL the response came from
+	Field    string // JSON name of the unmodelled field, as a dotted path for nested fields, e.g. "result.newField"
+}
+
+func (e *UnknownFieldError) Error() string {
+	return fmt.Sprintf("response from %s has field %q not modelled by the SDK", e.Endpoint, e.Field)
+}
+
+// Version of this SDK, reported to the API server in the User-Agent header
+const Version = "0.1.0"
+
+// API regions accepted by the constructors; an empty region means RegionUS
+// A http or https base URL is also accepted in place of a region, though WithBaseURL is preferred
+const (
+	RegionUS = "us"
+	RegionEU = "eu"
 )
 
 type APIError struct {
@@ -13,6 +115,44 @@ type APIError struct {
 	Message string `json:"message"`
 }
 
+// API error codes, for comparing against APIError.Code
+// See the API reference for the complete list: https://developer.idanalyzer.com/coreapi.html
+const (
+	// The API key is missing or invalid
+	ErrCodeInvalidAPIKey uint = 1
+	// The account has used up its API quota and credit
+	ErrCodeOutOfQuota uint = 8
+	// No supported document could be found in the image
+	ErrCodeDocumentNotRecognized uint = 9
+	// The document wasn't issued by one of the countries set with RestrictCountry
+	ErrCodeCountryRestricted uint = 10
+	// The document wasn't issued by one of the states set with RestrictState
+	ErrCodeStateRestricted uint = 11
+	// The document isn't one of the types set with RestrictType
+	ErrCodeTypeRestricted uint = 12
+	// The names, document number or document type differ between the front and back of the document (see EnableDualSideCheck)
+	ErrCodeDualSideMismatch uint = 14
+	// The phone number given to DocuPass SMSVerificationLink is invalid or unreachable
+	ErrCodeInvalidPhoneNumber uint = 1050
+)
+
+// API errors are returned as-is by every action, so callers can use errors.As to inspect the error code
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+// Returned when the API server responds with a non-2xx HTTP status, such as 429 when rate limited
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Body       []byte
+	RequestID  string // Request ID from the API server's response headers, for support tickets; empty if the server sent none
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("API server returned %s: %s", e.Status, e.Body)
+}
+
 type APIIdentityData struct {
 	DocumentNumber      string `json:"documentNumber"`
 	PersonalNumber      string `json:"personalNumber"`
@@ -67,11 +207,286 @@ type APIIdentityData struct {
 	InternalID          string `json:"internalId"`
 }
 
+// Number of days until the document expires, as reported by the API at scan time
+// Prefer this over the (misspelled) DaysToExipry field, which is kept for wire compatibility
+func (d APIIdentityData) DaysToExpiry() uint {
+	return d.DaysToExipry
+}
+
+// Whether the document had expired as of the given time, re-evaluated from the expiry date rather than the scan-time DaysToExipry
+// The document is treated as valid through the end of its expiry day
+// Returns an error if the expiry date is missing or unparseable, so the caller can decide how to treat an unknown expiry
+func (d APIIdentityData) IsExpired(asOf time.Time) (bool, error) {
+	expiresAt, err := d.expiresAt()
+	if err != nil {
+		return false, err
+	}
+
+	return !asOf.Before(expiresAt), nil
+}
+
+// Time remaining until the document expires at the end of its expiry day, as with IsExpired
+// Negative once the document has expired; zero if the expiry date is missing or unparseable
+func (d APIIdentityData) TimeToExpiry() time.Duration {
+	expiresAt, err := d.expiresAt()
+	if err != nil {
+		return 0
+	}
+
+	return time.Until(expiresAt)
+}
+
+// The instant the document stops being valid: the end of its expiry day
+func (d APIIdentityData) expiresAt() (time.Time, error) {
+	expiry, err := d.ExpiryTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return expiry.AddDate(0, 0, 1), nil
+}
+
+// Time elapsed since the document was issued, computed from the parsed issue date
+// Zero if the issue date is missing or unparseable
+func (d APIIdentityData) TimeSinceIssue() time.Duration {
+	issued, err := d.IssuedTime()
+	if err != nil {
+		return 0
+	}
+
+	return time.Since(issued)
+}
+
+// Header carrying the idempotency key of a request, set with WithIdempotencyKey or WithAutoIdempotencyKeys
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// Send key in the IdempotencyKeyHeader of every request made with the returned context, so a server can recognise a
+// retried call as a duplicate of one it already processed; use a new key per logical operation, reusing it only to retry
+// NOTE: idempotency keys are not documented by ID Analyzer; a server that ignores the header treats each retry as a
+// new request, which can use quota again
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContext{}, key)
+}
+
+// Configures connection settings at construction time, and is accepted by every API constructor
+type ClientOption func(a *apiClient) error
+
+func (o ClientOption) applyCore(c *CoreAPI) error {
+	return o(&c.apiClient)
+}
+
+func (o ClientOption) applyAML(a *AMLAPI) error {
+	return o(&a.apiClient)
+}
+
+// Send requests with a custom HTTP client, for example to configure proxies, TLS or transport-level timeouts
+// Defaults to http.DefaultClient
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(a *apiClient) error {
+		if client == nil {
+			return errors.New("HTTP client required")
+		}
+		a.httpClient = client
+
+		return nil
+	}
+}
+
+// Give up on requests after timeout, as with SetTimeout, whenever the request context has no deadline of its own
+// The timeout applies on top of any client set WithHTTPClient, so whichever limit is reached first wins
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(a *apiClient) error {
+		if timeout < 0 {
+			return errors.New("invalid timeout; must not be negative")
+		}
+		a.timeout = timeout
+
+		return nil
+	}
+}
+
+// Send requests to endpoint verbatim, instead of the endpoint chosen by region
+// Only http and https URLs are accepted, and any trailing slash is removed
+func WithEndpoint(endpoint string) ClientOption {
+	return func(a *apiClient) error {
+		return a.setEndpoint(endpoint)
+	}
+}
+
+// Append your application's name (e.g. "myapp/2.1") to the SDK's User-Agent header, to identify your traffic in access logs
+func WithUserAgent(product string) ClientOption {
+	return func(a *apiClient) error {
+		if product == "" {
+			return errors.New("user agent product required")
+		}
+		a.userAgent = product
+
+		return nil
+	}
+}
+
+// Tag requests with name instead of "go-sdk" in the client field, to tell your traffic apart in ID Analyzer's logs
+func WithClientName(name string) ClientOption {
+	return func(a *apiClient) error {
+		if name == "" {
+			return errors.New("client name required")
+		}
+		a.clientName = name
+
+		return nil
+	}
+}
+
+// Limit requests to rps per second on average, with bursts of up to burst requests
+// Waiting for the limiter respects the request context, so a cancelled context stops the wait
+// Passing the same option value to several constructors makes those clients share one limit, matching an account-wide quota
+// NOTE: this is a client-side limit only; the API server still enforces its own limits
+func WithRateLimit(rps float64, burst int) ClientOption {
+	limiter := rate.NewLimiter(rate.Limit(rps), burst)
+
+	return func(a *apiClient) error {
+		if rps <= 0 {
+			return errors.New("rate limit must be greater than 0")
+		}
+		if burst < 1 {
+			return errors.New("rate limit burst must be at least 1")
+		}
+		a.limiter = limiter
+
+		return nil
+	}
+}
+
+// Compare each API response against the JSON fields of its type, passing every field the SDK doesn't model to report
+// as an *UnknownFieldError, to catch changes to the API early
+// Responses are still decoded and returned as usual, so report is only a warning; it may be called from several goroutines
+// Off by default, as the API adding fields is not an error; intended for development and monitoring
+func WithStrictDecoding(report func(err error)) ClientOption {
+	return func(a *apiClient) error {
+		if report == nil {
+			return errors.New("strict decoding report function required")
+		}
+		a.reportUnknownField = report
+
+		return nil
+	}
+}
+
+// Give every request a random idempotency key when its context has none from WithIdempotencyKey
+// The key covers resends of the same HTTP request, e.g. by a retrying transport set WithHTTPClient, but a call made again
+// by the caller gets a new key; see WithIdempotencyKey for the limits of server support
+func WithAutoIdempotencyKeys() ClientOption {
+	return func(a *apiClient) error {
+		a.autoIdempotency = true
+
+		return nil
+	}
+}
+
+// Send requests to an ID Analyzer deployment at baseURL instead of the one chosen by region
+// The API's own path (e.g. /vault) is appended, so the same base URL can be passed to every constructor
+func WithBaseURL(baseURL string) ClientOption {
+	return func(a *apiClient) error {
+		base, err := normalizeEndpoint(baseURL)
+		if err != nil {
+			return err
+		}
+		a.apiEndpoint = fmt.Sprintf("%s/%s", base, a.apiPath)
+
+		return nil
+	}
+}
+
+// Returned by the date accessors when the document only gives part of a date, such as a birth year without month or day
+// Use the split day/month/year fields directly in that case
+var ErrPartialDate = errors.New("date is only partially known")
+
+// Date of birth as a time.Time, parsed from the API's YYYY/MM/DD format
+func (d APIIdentityData) DOBTime() (time.Time, error) {
+	return parseAPIDate(d.DOB, d.DOBYear, d.DOBMonth, d.DOBDay)
+}
+
+// Document expiry date as a time.Time, parsed from the API's YYYY/MM/DD format
+func (d APIIdentityData) ExpiryTime() (time.Time, error) {
+	return parseAPIDate(d.Expiry, d.ExpiryYear, d.ExpiryMonth, d.ExpiryDay)
+}
+
+// Document issue date as a time.Time, parsed from the API's YYYY/MM/DD format
+func (d APIIdentityData) IssuedTime() (time.Time, error) {
+	return parseAPIDate(d.Issued, d.IssuedYear, d.IssuedMonth, d.IssuedDay)
+}
+
 type APIContractData struct {
 	DocumentURL string `json:"document_url,omitempty"`
 	Error       string `json:"error,omitempty"`
 }
 
+// Largest contract Download will fetch
+const maxContractSize int64 = 64 << 20
+
+// Download the generated contract (PDF, DOCX or HTML, as requested), returning its bytes and content type
+// client may be nil to use http.DefaultClient; without a deadline on ctx the download times out after 60 seconds
+// A contract that failed to generate returns its Error as a Go error, and a non-2xx response is an *HTTPError
+func (c APIContractData) Download(ctx context.Context, client *http.Client) ([]byte, string, error) {
+	if c.Error != "" {
+		return nil, "", fmt.Errorf("contract generation failed: %s", c.Error)
+	}
+	if !isRemoteURL(c.DocumentURL) {
+		return nil, "", errors.New("no contract document URL")
+	}
+
+	data, header, err := download(ctx, client, c.DocumentURL, maxContractSize)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to download contract: %w", err)
+	}
+
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+
+	return data, contentType, nil
+}
+
+// Download a generated contract and return its hex-encoded SHA-256 hash
+// Record this when the contract is first received so the document can later be checked with VerifyContract
+func ContractHash(contractURL string) (string, error) {
+	return ContractHashContext(context.Background(), nil, contractURL)
+}
+
+// Download a generated contract and return its hex-encoded SHA-256 hash, bounded by ctx
+// client may be nil to use http.DefaultClient; without a deadline on ctx the download times out after 60 seconds
+func ContractHashContext(ctx context.Context, client *http.Client, contractURL string) (string, error) {
+	data, _, err := download(ctx, client, contractURL, maxContractSize)
+	if err != nil {
+		return "", fmt.Errorf("failed to download contract: %w", err)
+	}
+
+	hash := sha256.Sum256(data)
+
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// Download a generated contract and check it against a previously recorded SHA-256 hash (hex-encoded)
+// The API doesn't return a contract hash itself, so expectedHash must come from your own records (see ContractHash)
+func VerifyContract(contractURL, expectedHash string) (bool, error) {
+	return VerifyContractContext(context.Background(), nil, contractURL, expectedHash)
+}
+
+// Download a generated contract and check it against a previously recorded SHA-256 hash (hex-encoded), bounded by ctx
+func VerifyContractContext(ctx context.Context, client *http.Client, contractURL, expectedHash string) (bool, error) {
+	if expectedHash == "" {
+		return false, errors.New("expected hash required")
+	}
+
+	actualHash, err := ContractHashContext(ctx, client, contractURL)
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare([]byte(actualHash), []byte(strings.ToLower(expectedHash))) == 1, nil
+}
+
 type APIFaceData struct {
 	IsIdentical  bool    `json:"isIdentical"`
 	Confidence   float32 `json:"confidence"`
@@ -103,6 +518,17 @@ type APIAuthenticationData struct {
 	Warning   []string                    `json:"warning"`
 }
 
+// Names (as in the JSON response) of the breakdown sections that didn't pass, e.g. "exif_check" or "recapture_check"
+// Sections missing from the response are skipped, and a missing breakdown gives an empty list
+func (a APIAuthenticationData) FailedSections() []string {
+	return failedSections(a.Breakdown)
+}
+
+// Whether the document scored at least minScore (0 to 1) and no breakdown section failed
+func (a APIAuthenticationData) IsAuthentic(minScore float32) bool {
+	return a.Score >= minScore && len(a.FailedSections()) == 0
+}
+
 type APIAuthenticationBreakdown struct {
 	DataVisibility       *APIAuthenticationBreakdownSection `json:"data_visibility"`
 	ImageQuality         *APIAuthenticationBreakdownSection `json:"image_quality"`
@@ -122,6 +548,216 @@ type APIAuthenticationBreakdownSection struct {
 	Severity string `json:"severity,omitempty"`
 }
 
+// A flat, serializable summary of a scan's identity, verification, authentication and AML results, for audit logs
+type ComplianceRecord struct {
+	ResponseID             string   `json:"responseID"`
+	VaultID                string   `json:"vaultid,omitempty"`
+	DocumentNumber         string   `json:"documentNumber"`
+	DocumentType           string   `json:"documentType"`
+	DocumentName           string   `json:"documentName"`
+	IssuerOrgISO2          string   `json:"issuerOrg_iso2"`
+	FullName               string   `json:"fullName"`
+	DOB                    string   `json:"dob"`
+	Expiry                 string   `json:"expiry"`
+	FaceChecked            bool     `json:"face_checked"`
+	FaceIdentical          bool     `json:"face_identical"`
+	FaceConfidence         float32  `json:"face_confidence"`
+	VerificationChecked    bool     `json:"verification_checked"`
+	VerificationPassed     bool     `json:"verification_passed"`
+	VerifiedCheckDigit     bool     `json:"verified_checkdigit"`
+	VerifiedFace           bool     `json:"verified_face"`
+	VerifiedNotExpired     bool     `json:"verified_notexpired"`
+	VerifiedDocumentNumber bool     `json:"verified_documentNumber"`
+	VerifiedName           bool     `json:"verified_name"`
+	VerifiedAge            bool     `json:"verified_age"`
+	VerifiedDOB            bool     `json:"verified_dob"`
+	VerifiedAddress        bool     `json:"verified_address"`
+	VerifiedPostcode       bool     `json:"verified_postcode"`
+	VerifiedCCCode         bool     `json:"verified_cccode"`
+	AuthenticationChecked  bool     `json:"authentication_checked"`
+	AuthenticationScore    float32  `json:"authentication_score"`
+	AuthenticationFailed   []string `json:"authentication_failed"`
+	AuthenticationWarnings []string `json:"authentication_warnings"`
+	AMLChecked             bool     `json:"aml_checked"`
+	AMLMatched             bool     `json:"aml_matched"`
+	AMLMatchCount          uint     `json:"aml_match_count"`
+	AMLDatabases           []string `json:"aml_databases"`
+}
+
+// Totals API calls per operation over the process lifetime, and tracks the remaining quota and credit last reported by the API
+// ID Analyzer has no usage history endpoint, so this only sees calls made through clients it's attached to
+// A single recorder is safe to share between clients and goroutines
+type UsageRecorder struct {
+	mutex  sync.Mutex
+	calls  map[string]uint
+	quota  uint
+	credit uint
+}
+
+// Remaining balance as last reported by the API, along with calls made per operation since the recorder was created
+type Usage struct {
+	Calls           map[string]uint `json:"calls"`
+	TotalCalls      uint            `json:"total_calls"`
+	RemainingQuota  uint            `json:"remaining_quota"`
+	RemainingCredit uint            `json:"remaining_credit"`
+}
+
+func NewUsageRecorder() *UsageRecorder {
+	return &UsageRecorder{calls: map[string]uint{}}
+}
+
+// Record one call to operation, along with the remaining quota and credit it reported (zero if not reported)
+func (u *UsageRecorder) Record(operation string, quota, credit uint) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if u.calls == nil {
+		u.calls = map[string]uint{}
+	}
+	u.calls[operation]++
+	if quota != 0 || credit != 0 {
+		u.quota = quota
+		u.credit = credit
+	}
+}
+
+// Get a snapshot of the usage recorded so far
+func (u *UsageRecorder) Usage() Usage {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	usage := Usage{
+		Calls:           map[string]uint{},
+		RemainingQuota:  u.quota,
+		RemainingCredit: u.credit,
+	}
+	for operation, calls := range u.calls {
+		usage.Calls[operation] = calls
+		usage.TotalCalls += calls
+	}
+
+	return usage
+}
+
+// An image or video supplied to the API, declared explicitly as a URL or as content from a particular source
+// Use DetectImageInput for the URL/file/base64 guesswork the string-based methods do
+type ImageInput interface {
+	// Resolve to either a URL or base64-encoded content, reading at most maxSize bytes of content (0 for the default)
+	resolve(maxSize int64) (url, content string, err error)
+}
+
+// An image hosted at a remote http or https URL
+type URLInput string
+
+// An image stored in a file on the local filesystem
+type FileInput string
+
+// Image content that has already been base64 encoded
+type Base64Input string
+
+// Raw image content
+type BytesInput []byte
+
+// Image content read from an io.Reader
+type ReaderInput struct {
+	Reader io.Reader
+}
+
+// An image stored in a file in an fs.FS, such as an embed.FS
+type FSInput struct {
+	FS   fs.FS
+	Name string
+}
+
+func (u URLInput) resolve(maxSize int64) (string, string, error) {
+	if !isRemoteURL(string(u)) {
+		return "", "", errors.New("malformed URL, only http and https URLs are accepted")
+	}
+
+	return string(u), "", nil
+}
+
+func (f FileInput) resolve(maxSize int64) (string, string, error) {
+	if !fileExists(string(f)) {
+		return "", "", errors.New("file not found")
+	}
+
+	content, err := base64File(string(f), maxSize)
+	return "", content, err
+}
+
+// Data URI prefixes such as "data:image/jpeg;base64," are stripped, and the content must decode as standard base64
+func (b Base64Input) resolve(maxSize int64) (string, string, error) {
+	content, err := stripDataURI(string(b))
+	if err != nil {
+		return "", "", err
+	}
+
+	if content == "" {
+		return "", "", errors.New("no image data")
+	}
+
+	if _, err := base64.StdEncoding.DecodeString(content); err != nil {
+		return "", "", fmt.Errorf("invalid base64 content: %s", err.Error())
+	}
+
+	return "", content, nil
+}
+
+func (b BytesInput) resolve(maxSize int64) (string, string, error) {
+	if len(b) == 0 {
+		return "", "", errors.New("no image data")
+	}
+
+	return ReaderInput{Reader: bytes.NewReader(b)}.resolve(maxSize)
+}
+
+func (r ReaderInput) resolve(maxSize int64) (string, string, error) {
+	if r.Reader == nil {
+		return "", "", errors.New("no image data")
+	}
+
+	content, err := base64Reader(r.Reader, maxSize)
+	return "", content, err
+}
+
+func (f FSInput) resolve(maxSize int64) (string, string, error) {
+	if f.FS == nil {
+		return "", "", errors.New("no filesystem given")
+	}
+
+	file, err := f.FS.Open(f.Name)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	if maxSize <= 0 {
+		maxSize = defaultMaxUploadSize
+	}
+	if info, err := file.Stat(); err == nil && info.Size() > maxSize {
+		return "", "", fmt.Errorf("input exceeds maximum upload size of %d bytes", maxSize)
+	}
+
+	content, err := base64Reader(file, maxSize)
+	return "", content, err
+}
+
+// Work out what kind of input an image string is, the way the string-based methods do: a URL if it's an http(s) URL,
+// otherwise a file if one exists at that path, otherwise base64 content if it's long enough to plausibly be an image
+// Reports false if it's none of these
+func DetectImageInput(image string) (ImageInput, bool) {
+	if isRemoteURL(image) {
+		return URLInput(image), true
+	} else if fileExists(image) {
+		return FileInput(image), true
+	} else if len(image) > 100 {
+		return Base64Input(image), true
+	}
+
+	return nil, false
+}
+
 var ZeroValue = reflect.Value{}
 var privateIPBlocks []*net.IPNet
 
@@ -144,31 +780,759 @@ func init() {
 	}
 }
 
-func endpointFromRegion(region, api string) string {
+// Any region other than US or EU must be a http or https base URL, which is kept for backwards compatibility; prefer WithBaseURL
+func endpointFromRegion(region, api string) (string, error) {
 	switch region {
 	case "us", "US", "":
-		return fmt.Sprintf("https://api.idanalyzer.com/%s", api)
+		return fmt.Sprintf("https://api.idanalyzer.com/%s", api), nil
 	case "eu", "EU":
-		return fmt.Sprintf("https://api-eu.idanalyzer.com/%s", api)
-	default:
-		return fmt.Sprintf("%s/%s", region, api)
+		return fmt.Sprintf("https://api-eu.idanalyzer.com/%s", api), nil
+	}
+
+	base, err := normalizeEndpoint(region)
+	if err != nil {
+		return "", fmt.Errorf("unknown region %q, expected %q, %q or a http(s) base URL", region, RegionUS, RegionEU)
+	}
+
+	return fmt.Sprintf("%s/%s", base, api), nil
+}
+
+// Apply a client's default timeout to ctx, unless ctx already carries a deadline of its own
+func withDefaultTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Connection settings shared by every API client
+type apiClient struct {
+	apiKey      string
+	apiEndpoint string
+	apiPath     string
+	timeout     time.Duration
+	httpClient  *http.Client
+	userAgent   string
+	clientName  string
+	limiter     *rate.Limiter
+
+	autoIdempotency    bool
+	reportUnknownField func(err error)
+}
+
+type idempotencyKeyContext struct{}
+
+func newAPIClient(apiKey, region, apiPath string) (apiClient, error) {
+	endpoint, err := endpointFromRegion(region, apiPath)
+	if err != nil {
+		return apiClient{}, err
+	}
+
+	return apiClient{
+		apiKey:      apiKey,
+		apiEndpoint: endpoint,
+		apiPath:     apiPath,
+	}, nil
+}
+
+func (a *apiClient) setEndpoint(endpoint string) error {
+	normalized, err := normalizeEndpoint(endpoint)
+	if err != nil {
+		return err
+	}
+	a.apiEndpoint = normalized
+
+	return nil
+}
+
+func normalizeEndpoint(endpoint string) (string, error) {
+	uri, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid endpoint: %s", err.Error())
+	}
+	if (uri.Scheme != "http" && uri.Scheme != "https") || uri.Host == "" {
+		return "", errors.New("invalid endpoint, http or https URL required")
+	}
+
+	return strings.TrimRight(endpoint, "/"), nil
+}
+
+// POST payload as JSON to endpoint and decode the response into result
+// The raw response body is returned (as a fresh copy) whenever one was read, even if it could not be parsed
+func (a *apiClient) doJSON(ctx context.Context, endpoint string, payload, result interface{}) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+
+	response, err := a.postJSON(ctx, endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to API server: %w", err)
+	}
+	defer response.Body.Close()
+
+	body, err = readResponse(response)
+	if err != nil {
+		return nil, err
+	}
+	setRequestID(result, response.Header)
+
+	if err := parseResponse(body, result); err != nil {
+		return body, err
+	}
+	a.checkUnknownFields(endpoint, body, result)
+
+	return body, nil
+}
+
+// The key set on ctx with WithIdempotencyKey, else a random key when built WithAutoIdempotencyKeys, else ""
+func (a *apiClient) idempotencyKey(ctx context.Context) (string, error) {
+	if key, ok := ctx.Value(idempotencyKeyContext{}).(string); ok && key != "" {
+		return key, nil
+	}
+	if !a.autoIdempotency {
+		return "", nil
+	}
+
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate idempotency key: %s", err.Error())
+	}
+
+	return hex.EncodeToString(key), nil
+}
+
+func (a *apiClient) postJSON(ctx context.Context, endpoint string, body []byte) (*http.Response, error) {
+	return a.doRequest(ctx, http.MethodPost, endpoint, "application/json", bytes.NewReader(body))
+}
+
+// Every request made by the SDK goes through here, so headers are set consistently
+func (a *apiClient) doRequest(ctx context.Context, method, endpoint, contentType string, body io.Reader) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	request.Header.Set("User-Agent", a.userAgentHeader())
+	if method != http.MethodGet {
+		key, err := a.idempotencyKey(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if key != "" {
+			request.Header.Set(IdempotencyKeyHeader, key)
+		}
+	}
+
+	if a.limiter != nil {
+		if err := a.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	httpClient := a.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return httpClient.Do(request)
+}
+
+// Value sent in the client field of every request
+func (a *apiClient) client() string {
+	if a.clientName == "" {
+		return "go-sdk" // this request is coming from the Go SDK!
+	}
+
+	return a.clientName
+}
+
+func (a *apiClient) userAgentHeader() string {
+	if a.userAgent == "" {
+		return fmt.Sprintf("idanalyzer-go-sdk/%s", Version)
+	}
+
+	return fmt.Sprintf("idanalyzer-go-sdk/%s %s", Version, a.userAgent)
+}
+
+func readResponse(response *http.Response) ([]byte, error) {
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API response: %w", err)
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return body, &HTTPError{StatusCode: response.StatusCode, Status: response.Status, Body: body, RequestID: requestID(response.Header)}
+	}
+
+	return body, nil
+}
+
+// Headers the API server or its proxies may identify a request by, in order of preference
+// The API doesn't document a request ID header of its own, so the common ones are all checked
+var requestIDHeaders = []string{"X-Request-Id", "X-Amzn-Requestid", "Cf-Ray"}
+
+func requestID(header http.Header) string {
+	for _, name := range requestIDHeaders {
+		if id := header.Get(name); id != "" {
+			return id
+		}
 	}
+
+	return ""
+}
+
+// Store the request ID in result's RequestID field, for the response types that have one
+func setRequestID(result interface{}, header http.Header) {
+	value := reflect.ValueOf(result)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return
+	}
+
+	if field := value.Elem().FieldByName("RequestID"); field.IsValid() && field.CanSet() && field.Kind() == reflect.String {
+		field.SetString(requestID(header))
+	}
+}
+
+func parseResponse(body []byte, result interface{}) error {
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("failed to parse API response: %w (body: %s)", err, body)
+	}
+
+	return nil
+}
+
+// Report each field of body that result doesn't model, when built WithStrictDecoding
+func (a *apiClient) checkUnknownFields(endpoint string, body []byte, result interface{}) {
+	if a.reportUnknownField == nil {
+		return
+	}
+
+	seen := map[string]bool{}
+	for _, field := range unknownFields("", body, reflect.TypeOf(result)) {
+		if !seen[field] {
+			seen[field] = true
+			a.reportUnknownField(&UnknownFieldError{Endpoint: endpoint, Field: field})
+		}
+	}
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// Paths of the object keys in raw with no matching field in t, descending into nested structs and slices of them
+// Keys are matched case-insensitively, as encoding/json does; types that decode themselves are not looked into
+func unknownFields(path string, raw json.RawMessage, t reflect.Type) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(jsonUnmarshalerType) {
+		return nil
+	}
+
+	var unknown []string
+	switch t.Kind() {
+	case reflect.Struct:
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &object); err != nil {
+			return nil
+		}
+
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fields := jsonFields(t)
+		for _, key := range keys {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+
+			if fieldType, ok := fields[strings.ToLower(key)]; ok {
+				unknown = append(unknown, unknownFields(fieldPath, object[key], fieldType)...)
+			} else {
+				unknown = append(unknown, fieldPath)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil
+		}
+
+		for _, item := range items {
+			unknown = append(unknown, unknownFields(path, item, t.Elem())...)
+		}
+	}
+
+	return unknown
+}
+
+// Types of the fields encoding/json decodes into a struct of type t, keyed by lowercased JSON name
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for key, fieldType := range jsonFields(embedded) {
+					if _, ok := fields[key]; !ok {
+						fields[key] = fieldType
+					}
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		fields[strings.ToLower(name)] = field.Type
+	}
+
+	return fields
+}
+
+func isRemoteURL(image string) bool {
+	uri, err := url.ParseRequestURI(image)
+	return err == nil && (uri.Scheme == "http" || uri.Scheme == "https") && uri.Host != ""
 }
 
 func fileExists(filename string) bool {
 	info, err := os.Stat(filename)
-	if os.IsNotExist(err) {
+	if err != nil {
 		return false
 	}
 	return !info.IsDir()
 }
 
-func base64File(filename string) (encoded string) {
-	if file, err := os.ReadFile(filename); err == nil {
-		encoded = base64.StdEncoding.EncodeToString(file)
+// In strict input mode, refuse image arguments that could be read either as a URL or as a local file path
+func checkAmbiguousImage(image string) error {
+	if image == "" {
+		return nil
+	}
+
+	if isRemoteURL(image) && fileExists(image) {
+		return fmt.Errorf("ambiguous image %q is both a valid URL and an existing file; use URLInput or FileInput instead", image)
+	}
+
+	return nil
+}
+
+// Encode a file without first reading it fully into memory, refusing files larger than limit before reading anything
+func base64File(filename string, limit int64) (string, error) {
+	if limit <= 0 {
+		limit = defaultMaxUploadSize
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err == nil && info.Size() > limit {
+		return "", fmt.Errorf("input exceeds maximum upload size of %d bytes", limit)
+	}
+
+	return base64Reader(file, limit)
+}
+
+func newComplianceRecord(responseID, vaultID string, identity *APIIdentityData, face *APIFaceData, verification *APIVerificationData, authentication *APIAuthenticationData, aml *AMLResponse) ComplianceRecord {
+	record := ComplianceRecord{
+		ResponseID:             responseID,
+		VaultID:                vaultID,
+		AuthenticationFailed:   []string{},
+		AuthenticationWarnings: []string{},
+		AMLDatabases:           []string{},
+	}
+
+	if identity != nil {
+		record.DocumentNumber = identity.DocumentNumber
+		record.DocumentType = identity.DocumentType
+		record.DocumentName = identity.DocumentName
+		record.IssuerOrgISO2 = identity.IssuerOrgISO2
+		record.FullName = identity.FullName
+		record.DOB = identity.DOB
+		record.Expiry = identity.Expiry
+	}
+
+	if face != nil {
+		record.FaceChecked = true
+		record.FaceIdentical = face.IsIdentical
+		record.FaceConfidence = face.Confidence
+	}
+
+	if verification != nil {
+		record.VerificationChecked = true
+		record.VerificationPassed = verification.Passed
+		record.VerifiedCheckDigit = verification.Result.CheckDigit
+		record.VerifiedFace = verification.Result.Face
+		record.VerifiedNotExpired = verification.Result.NotExpired
+		record.VerifiedDocumentNumber = verification.Result.DocumentNumber
+		record.VerifiedName = verification.Result.Name
+		record.VerifiedAge = verification.Result.Age
+		record.VerifiedDOB = verification.Result.DOB
+		record.VerifiedAddress = verification.Result.Address
+		record.VerifiedPostcode = verification.Result.Postcode
+		record.VerifiedCCCode = verification.Result.CCCode
+	}
+
+	if authentication != nil {
+		record.AuthenticationChecked = true
+		record.AuthenticationScore = authentication.Score
+		record.AuthenticationFailed = authentication.FailedSections()
+		if authentication.Warning != nil {
+			record.AuthenticationWarnings = authentication.Warning
+		}
+	}
+
+	if aml != nil {
+		record.AMLChecked = true
+		record.AMLMatched = len(aml.Items) > 0
+		record.AMLMatchCount = uint(len(aml.Items))
+
+		seen := map[string]bool{}
+		for _, item := range aml.Items {
+			if item.Database != "" && !seen[item.Database] {
+				seen[item.Database] = true
+				record.AMLDatabases = append(record.AMLDatabases, item.Database)
+			}
+		}
+	}
+
+	return record
+}
+
+// Names (as in the JSON response) of the authentication breakdown sections that didn't pass
+func failedSections(breakdown *APIAuthenticationBreakdown) []string {
+	failed := []string{}
+	if breakdown == nil {
+		return failed
+	}
+
+	for _, section := range []struct {
+		name    string
+		section *APIAuthenticationBreakdownSection
+	}{
+		{"data_visibility", breakdown.DataVisibility},
+		{"image_quality", breakdown.ImageQuality},
+		{"feature_referencing", breakdown.FeatureReferencing},
+		{"exif_check", breakdown.EXIFCheck},
+		{"publicity_check", breakdown.PublicityCheck},
+		{"text_analysis", breakdown.TextAnalysis},
+		{"biometric_analysis", breakdown.BiometricAnalysis},
+		{"security_feature_check", breakdown.SecurityFeatureCheck},
+		{"recapture_check", breakdown.RecaptureCheck},
+	} {
+		if section.section != nil && !section.section.Passed {
+			failed = append(failed, section.name)
+		}
+	}
+
+	return failed
+}
+
+// Check that contract prefill data has no empty keys and encodes as JSON, naming the first bad key in the error
+// A copy is returned, so later changes to the caller's map don't alter what is sent
+func validatePrefillData(data map[string]interface{}) (map[string]interface{}, error) {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	prefill := make(map[string]interface{}, len(data))
+	for _, key := range keys {
+		if key == "" {
+			return nil, errors.New("invalid prefill data, field names must not be empty")
+		}
+		if _, err := json.Marshal(data[key]); err != nil {
+			return nil, fmt.Errorf("invalid prefill data for field %q: %s", key, err.Error())
+		}
+		prefill[key] = data[key]
+	}
+
+	return prefill, nil
+}
+
+// Remove any "data:...;base64," prefix, leaving only the base64 content
+func stripDataURI(content string) (string, error) {
+	if !strings.HasPrefix(content, "data:") {
+		return content, nil
+	}
+
+	if comma := strings.Index(content, ","); comma >= 0 && strings.HasSuffix(content[:comma], ";base64") {
+		return content[comma+1:], nil
+	}
+
+	return "", errors.New("unsupported data URI, only base64 data URIs are accepted")
+}
+
+// Decode an image returned by the Core API when image output is enabled in base64 mode
+func decodeOutputImage(output string) ([]byte, error) {
+	if output == "" {
+		return nil, errors.New("no image in response, enable image output with EnableImageOutput")
+	}
+	if isRemoteURL(output) {
+		return nil, errors.New("image output mode is url, not base64; use FetchCroppedImage instead")
+	}
+
+	content, err := stripDataURI(output)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 image: %s", err.Error())
+	}
+
+	return data, nil
+}
+
+// Largest image FetchCroppedImage, FetchCroppedFace and VaultAPI.GetImageBytes will download
+const maxOutputImageSize int64 = 32 << 20
+
+// Download an image returned by the Core API when image output is enabled in url mode
+func fetchOutputImage(ctx context.Context, client *http.Client, output string) ([]byte, error) {
+	if output == "" {
+		return nil, errors.New("no image in response, enable image output with EnableImageOutput")
+	}
+	if !isRemoteURL(output) {
+		return nil, errors.New("image output mode is base64, not url; use CroppedImageBytes instead")
+	}
+
+	data, _, err := download(ctx, client, output, maxOutputImageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image: %w", err)
+	}
+
+	return data, nil
+}
+
+// Timeout for downloads whose context has no deadline of its own
+const defaultDownloadTimeout = 60 * time.Second
+
+// GET a URL outside of any API client, so no rate limit or API headers apply, using client (http.DefaultClient if nil)
+// At most limit bytes of the body are read; a larger body is an error, as is a non-2xx response (as *HTTPError)
+func download(ctx context.Context, client *http.Client, url string, limit int64) ([]byte, http.Header, error) {
+	ctx, cancel := withDefaultTimeout(ctx, defaultDownloadTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer response.Body.Close()
+
+	data, err := readLimited(response, limit)
+	if err != nil {
+		return nil, response.Header, err
+	}
+
+	return data, response.Header, nil
+}
+
+// Read at most limit bytes of a response body; a larger body is an error, as is a non-2xx response (as *HTTPError)
+func readLimited(response *http.Response, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(response.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, &HTTPError{StatusCode: response.StatusCode, Status: response.Status, Body: data, RequestID: requestID(response.Header)}
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("body exceeds the %d byte download limit", limit)
+	}
+
+	return data, nil
+}
+
+// Parse a YYYY/MM/DD date as returned by the API, falling back to its split day/month/year fields
+func parseAPIDate(date string, year, month, day uint) (time.Time, error) {
+	if parsed, err := time.Parse("2006/01/02", date); err == nil {
+		return parsed, nil
+	}
+
+	if year != 0 && (month == 0 || day == 0) {
+		return time.Time{}, ErrPartialDate
+	}
+	if year == 0 || month == 0 || day == 0 {
+		return time.Time{}, fmt.Errorf("invalid date %q", date)
+	}
+
+	return time.Date(int(year), time.Month(month), int(day), 0, 0, 0, 0, time.UTC), nil
+}
+
+// Convert a YYYY/MM/DD or ISO YYYY-MM-DD date to the YYYY/MM/DD form the API expects for date verification
+func normalizeDOB(date string) (string, error) {
+	for _, layout := range []string{"2006/01/02", "2006-01-02"} {
+		if parsed, err := time.Parse(layout, date); err == nil {
+			return parsed.Format("2006/01/02"), nil
+		}
+	}
+
+	return "", errors.New("invalid birthday format (YYYY/MM/DD or YYYY-MM-DD)")
+}
+
+// List failed verification checks, using the raw response (when available) to skip checks the API didn't run
+func failedVerificationChecks(raw []byte, verification *APIVerificationData) []string {
+	if verification == nil {
+		return nil
+	}
+
+	var response struct {
+		Verification *struct {
+			Result map[string]bool `json:"result"`
+		} `json:"verification"`
+	}
+	if err := json.Unmarshal(raw, &response); err == nil && response.Verification != nil {
+		var failed []string
+		for check, passed := range response.Verification.Result {
+			if !passed {
+				failed = append(failed, check)
+			}
+		}
+		sort.Strings(failed)
+
+		return failed
+	}
+
+	var failed []string
+	result := reflect.ValueOf(verification.Result)
+	for i := 0; i < result.NumField(); i++ {
+		if !result.Field(i).Bool() {
+			failed = append(failed, result.Type().Field(i).Tag.Get("json"))
+		}
+	}
+
+	return failed
+}
+
+// Check every key of verifications has a setter, then apply them in key order, stopping at the first invalid value
+func applyVerifications(verifications map[string]string, setters map[string]func(value string) error) error {
+	valid := make([]string, 0, len(setters))
+	for key := range setters {
+		valid = append(valid, key)
+	}
+	sort.Strings(valid)
+
+	keys := make([]string, 0, len(verifications))
+	var unknown []string
+	for key := range verifications {
+		keys = append(keys, key)
+		if setters[key] == nil {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown verification keys %s; valid keys are %s", strings.Join(unknown, ", "), strings.Join(valid, ", "))
+	}
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := setters[key](verifications[key]); err != nil {
+			return fmt.Errorf("invalid %s verification: %s", key, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// Parse a "true"/"false" verification value
+func verificationBool(value string, set func(enabled bool)) error {
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return errors.New(`"true" or "false" accepted`)
+	}
+	set(enabled)
+
+	return nil
+}
+
+func validateCallbackUrl(callback string) error {
+	if uri, err := url.ParseRequestURI(callback); err != nil {
+		return errors.New("invalid URL format")
+	} else if ip := net.ParseIP(uri.Host); (ip != nil && isPrivateIP(ip)) || strings.ToLower(uri.Host) == "localhost" {
+		return errors.New("invalid URL, the host does not appear to be a remote host")
+	} else if uri.Scheme != "http" && uri.Scheme != "https" {
+		return errors.New("invalid URL, only http and https protocols are allowed")
+	}
+
+	return nil
+}
+
+// Sniff the format of raw image data, refusing anything other than the JPG, PNG and PDF files the API accepts
+func checkImageFormat(data []byte) error {
+	if len(data) == 0 {
+		return errors.New("no image data")
+	}
+
+	switch format := http.DetectContentType(data); format {
+	case "image/jpeg", "image/png", "application/pdf":
+		return nil
+	default:
+		return fmt.Errorf("unsupported format %s; JPG, PNG or PDF accepted", format)
+	}
+}
+
+const defaultMaxUploadSize int64 = 32 << 20
+
+// Read and encode at most limit bytes from reader, failing if there's more; a limit of 0 uses the default
+// The input is encoded as it streams in, so only the encoded form is ever held in memory, sized up front for files
+func base64Reader(reader io.Reader, limit int64) (string, error) {
+	if limit <= 0 {
+		limit = defaultMaxUploadSize
+	}
+
+	var encoded strings.Builder
+	if file, ok := reader.(interface{ Stat() (fs.FileInfo, error) }); ok {
+		if info, err := file.Stat(); err == nil && info.Size() <= limit {
+			encoded.Grow(base64.StdEncoding.EncodedLen(int(info.Size())))
+		}
+	}
+	encoder := base64.NewEncoder(base64.StdEncoding, &encoded)
+
+	read, err := io.Copy(encoder, io.LimitReader(reader, limit+1))
+	if err != nil {
+		return "", err
+	}
+	if read > limit {
+		return "", fmt.Errorf("input exceeds maximum upload size of %d bytes", limit)
 	}
+	encoder.Close()
 
-	return
+	return encoded.String(), nil
 }
 
 func isPrivateIP(ip net.IP) bool {
@@ -0,0 +1,186 @@
+package idanalyzer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestFSInputSizeLimit(t *testing.T) {
+	fsys := fstest.MapFS{"id.jpg": &fstest.MapFile{Data: bytes.Repeat([]byte{0xff}, 2048)}}
+
+	if _, _, err := (FSInput{FS: fsys, Name: "id.jpg"}).resolve(1024); err == nil || !strings.Contains(err.Error(), "maximum upload size of 1024 bytes") {
+		t.Fatalf("expected size limit error, got %v", err)
+	}
+
+	_, content, err := (FSInput{FS: fsys, Name: "id.jpg"}).resolve(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != base64.StdEncoding.EncodeToString(fsys["id.jpg"].Data) {
+		t.Error("content not encoded as base64")
+	}
+}
+
+// Compare streaming a large video through base64File against reading it whole before encoding
+func BenchmarkBase64File(b *testing.B) {
+	filename := filepath.Join(b.TempDir(), "selfie.mp4")
+	if err := os.WriteFile(filename, bytes.Repeat([]byte{0x42}, 64<<20), 0o600); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("ReadFile", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				b.Fatal(err)
+			}
+			_ = base64.StdEncoding.EncodeToString(data)
+		}
+	})
+
+	b.Run("Stream", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := base64File(filename, 128<<20); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestVerifyContractContext(t *testing.T) {
+	contract := []byte("%PDF-1.4 signed")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(contract)
+	}))
+	defer server.Close()
+
+	hash := sha256.Sum256(contract)
+	if ok, err := VerifyContractContext(context.Background(), server.Client(), server.URL, hex.EncodeToString(hash[:])); err != nil || !ok {
+		t.Errorf("expected the contract to verify, got %v, %v", ok, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := VerifyContractContext(ctx, server.Client(), server.URL, hex.EncodeToString(hash[:])); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestContractDownload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("%PDF-1.4 signed"))
+	}))
+	defer server.Close()
+
+	data, contentType, err := APIContractData{DocumentURL: server.URL + "/contract"}.Download(context.Background(), server.Client())
+	if err != nil || string(data) != "%PDF-1.4 signed" || contentType != "application/pdf" {
+		t.Errorf("expected the sniffed PDF contract, got %q, %q, %v", data, contentType, err)
+	}
+
+	var httpError *HTTPError
+	if _, _, err := (APIContractData{DocumentURL: server.URL + "/missing"}).Download(context.Background(), server.Client()); !errors.As(err, &httpError) || httpError.StatusCode != http.StatusNotFound {
+		t.Errorf("expected an *HTTPError for a missing contract, got %v", err)
+	}
+}
+
+func TestExpiryDayIsStillValid(t *testing.T) {
+	identity := APIIdentityData{Expiry: time.Now().UTC().Format("2006/01/02")}
+
+	if expired, err := identity.IsExpired(time.Now()); err != nil || expired {
+		t.Errorf("expected a document expiring today to be valid, got %v, %v", expired, err)
+	}
+	if remaining := identity.TimeToExpiry(); remaining <= 0 || remaining > 24*time.Hour {
+		t.Errorf("expected up to a day until the end of the expiry day, got %s", remaining)
+	}
+}
+
+func TestBase64InputResolve(t *testing.T) {
+	content := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0xff, 0xd8, 0xff}, 50))
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr string
+	}{
+		{"plain", content, content, ""},
+		{"data URI", "data:image/jpeg;base64," + content, content, ""},
+		{"non-base64 data URI", "data:image/jpeg," + content, "", "unsupported data URI"},
+		{"empty data URI", "data:image/jpeg;base64,", "", "no image data"},
+		{"invalid", content[:len(content)-1] + "!", "", "invalid base64 content"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, got, err := Base64Input(test.input).resolve(0)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("expected error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Errorf("expected %q, got %q, %v", test.want, got, err)
+			}
+		})
+	}
+}
+
+func TestDoJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" || !strings.HasPrefix(r.Header.Get("User-Agent"), "idanalyzer-go-sdk/") {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		w.Header().Set("X-Request-Id", "req-1")
+
+		switch r.URL.Path {
+		case "/ok":
+			w.Write([]byte(`{"reference":"ABC"}`))
+		case "/malformed":
+			w.Write([]byte(`{"reference":`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("upstream down"))
+		}
+	}))
+	defer server.Close()
+
+	client := &apiClient{httpClient: server.Client()}
+
+	var result DocuPassSignatureResponse
+	if _, err := client.doJSON(context.Background(), server.URL+"/ok", map[string]string{}, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Reference != "ABC" || result.RequestID != "req-1" {
+		t.Errorf("expected the decoded response with its request ID, got %+v", result)
+	}
+
+	body, err := client.doJSON(context.Background(), server.URL+"/malformed", map[string]string{}, &result)
+	if err == nil || !strings.Contains(err.Error(), "failed to parse API response") || string(body) != `{"reference":` {
+		t.Errorf("expected a parse error and the raw body, got %q, %v", body, err)
+	}
+
+	_, err = client.doJSON(context.Background(), server.URL+"/down", map[string]string{}, &result)
+	var httpError *HTTPError
+	if !errors.As(err, &httpError) || httpError.StatusCode != http.StatusBadGateway || httpError.RequestID != "req-1" {
+		t.Errorf("expected an *HTTPError for the 502, got %v", err)
+	}
+}
@@ -2,20 +2,37 @@ package idanalyzer
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"image"
+	"image/jpeg"
 	"io"
+	"io/fs"
+	"mime/multipart"
 	"net/http"
-	"net/url"
+	"net/textproto"
+	"reflect"
 	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
+// Scans may run concurrently, but setters are not safe to call while the client is in use by other goroutines
+// (unless built WithThreadSafe); configure a shared base client up front, then Clone it wherever a goroutine needs its own settings
 type CoreAPI struct {
-	apiKey      string
-	apiEndpoint string
-	config      coreConfig
+	apiClient
+	mutex         *sync.RWMutex
+	maxUploadSize int64
+	uploadMode    UploadMode
+	imageFormat   string
+	swapSides     bool
+	usage         *UsageRecorder
+	config        coreConfig
 }
 
 type CoreResponse1Side struct {
@@ -37,6 +54,8 @@ type CoreResponse1Side struct {
 	ResponseID     string                 `json:"responseID"`
 	Quota          uint                   `json:"quota,omitempty"`
 	Credit         uint                   `json:"credit,omitempty"`
+	RawResponse    []byte                 `json:"-"` // Copy of the exact JSON returned by the API
+	RequestID      string                 `json:"-"` // Request ID from the API server's response headers, for support tickets; empty if the server sent none
 }
 
 type CoreResponse2Sides struct {
@@ -58,6 +77,14 @@ type CoreResponse2Sides struct {
 	ResponseID     string                 `json:"responseID"`
 	Quota          uint                   `json:"quota,omitempty"`
 	Credit         uint                   `json:"credit,omitempty"`
+	RawResponse    []byte                 `json:"-"` // Copy of the exact JSON returned by the API
+	RequestID      string                 `json:"-"` // Request ID from the API server's response headers, for support tickets; empty if the server sent none
+}
+
+// Result of ScanAuto: OneSide is set when one image was scanned, BothSides when two were
+type CoreAutoResponse struct {
+	OneSide   *CoreResponse1Side
+	BothSides *CoreResponse2Sides
 }
 
 type CoreConfidence struct {
@@ -114,35 +141,468 @@ type CoreConfidence struct {
 	InternalID          float32 `json:"internalId"`
 }
 
+// The confidence for a field, named as in the JSON response, e.g. "documentNumber" or "issuerOrg_iso2"
+// ok is false for names CoreConfidence doesn't have
+func (c CoreConfidence) Field(name string) (confidence float32, ok bool) {
+	index, ok := coreConfidenceFields[name]
+	if !ok {
+		return 0, false
+	}
+
+	return float32(reflect.ValueOf(c).Field(index).Float()), true
+}
+
+// Names of the fields, as in the JSON response, whose confidence is below threshold, in struct order
+// Fields with a confidence of 0 were not reported by the API and are skipped
+func (c CoreConfidence) LowConfidenceFields(threshold float32) []string {
+	var low []string
+	value := reflect.ValueOf(c)
+	for i := 0; i < value.NumField(); i++ {
+		confidence := float32(value.Field(i).Float())
+		if confidence > 0 && confidence < threshold {
+			low = append(low, value.Type().Field(i).Tag.Get("json"))
+		}
+	}
+
+	return low
+}
+
+// Summarize the scan result into a flat record suitable for audit logs
+func (r CoreResponse1Side) ComplianceRecord() ComplianceRecord {
+	return newComplianceRecord(r.ResponseID, r.VaultID, r.Result, r.Face, r.Verification, r.Authentication, r.AML)
+}
+
+// Summarize the scan result into a flat record suitable for audit logs
+func (r CoreResponse2Sides) ComplianceRecord() ComplianceRecord {
+	return newComplianceRecord(r.ResponseID, r.VaultID, r.Result, r.Face, r.Verification, r.Authentication, r.AML)
+}
+
+// Whether every verification requested for the scan passed; false if no verification was returned
+func (r CoreResponse1Side) Passed() bool {
+	return r.Verification != nil && r.Verification.Passed
+}
+
+// JSON names of the verification checks that failed, e.g. "checkdigit" or "dob"
+// Only checks the API actually ran are listed, so checks that weren't requested aren't reported as failures
+func (r CoreResponse1Side) FailedChecks() []string {
+	return failedVerificationChecks(r.RawResponse, r.Verification)
+}
+
+// Decoded cropped document image, when image output is enabled in base64 mode
+func (r CoreResponse1Side) CroppedImageBytes() ([]byte, error) {
+	return decodeOutputImage(r.Cropped)
+}
+
+// Decoded cropped face image, when image output is enabled in base64 mode
+func (r CoreResponse1Side) CroppedFaceBytes() ([]byte, error) {
+	return decodeOutputImage(r.CroppedFace)
+}
+
+// Download the cropped document image, when image output is enabled in url mode
+// client may be nil to use http.DefaultClient; the download is limited to 32MB
+func (r CoreResponse1Side) FetchCroppedImage(ctx context.Context, client *http.Client) ([]byte, error) {
+	return fetchOutputImage(ctx, client, r.Cropped)
+}
+
+// Download the cropped face image, when image output is enabled in url mode
+func (r CoreResponse1Side) FetchCroppedFace(ctx context.Context, client *http.Client) ([]byte, error) {
+	return fetchOutputImage(ctx, client, r.CroppedFace)
+}
+
+// Whether every verification requested for the scan passed; false if no verification was returned
+func (r CoreResponse2Sides) Passed() bool {
+	return r.Verification != nil && r.Verification.Passed
+}
+
+// JSON names of the verification checks that failed, e.g. "checkdigit" or "dob"
+// Only checks the API actually ran are listed, so checks that weren't requested aren't reported as failures
+func (r CoreResponse2Sides) FailedChecks() []string {
+	return failedVerificationChecks(r.RawResponse, r.Verification)
+}
+
+// Decoded cropped document images, one per side, when image output is enabled in base64 mode
+func (r CoreResponse2Sides) CroppedImageBytes() ([][]byte, error) {
+	if len(r.Cropped) == 0 {
+		return nil, errors.New("no image in response, enable image output with EnableImageOutput")
+	}
+
+	images := make([][]byte, len(r.Cropped))
+	for i, cropped := range r.Cropped {
+		data, err := decodeOutputImage(cropped)
+		if err != nil {
+			return nil, err
+		}
+		images[i] = data
+	}
+
+	return images, nil
+}
+
+// Decoded cropped face image, when image output is enabled in base64 mode
+func (r CoreResponse2Sides) CroppedFaceBytes() ([]byte, error) {
+	return decodeOutputImage(r.CroppedFace)
+}
+
+// Download the cropped document images, one per side, when image output is enabled in url mode
+// client may be nil to use http.DefaultClient; each download is limited to 32MB
+func (r CoreResponse2Sides) FetchCroppedImage(ctx context.Context, client *http.Client) ([][]byte, error) {
+	if len(r.Cropped) == 0 {
+		return nil, errors.New("no image in response, enable image output with EnableImageOutput")
+	}
+
+	images := make([][]byte, len(r.Cropped))
+	for i, cropped := range r.Cropped {
+		data, err := fetchOutputImage(ctx, client, cropped)
+		if err != nil {
+			return nil, err
+		}
+		images[i] = data
+	}
+
+	return images, nil
+}
+
+// Download the cropped face image, when image output is enabled in url mode
+func (r CoreResponse2Sides) FetchCroppedFace(ctx context.Context, client *http.Client) ([]byte, error) {
+	return fetchOutputImage(ctx, client, r.CroppedFace)
+}
+
+// OCR accuracy levels for SetAccuracy, SetAccuracyForType and WithAccuracy
+const (
+	AccuracyFast     uint = 0
+	AccuracyBalanced uint = 1
+	AccuracyAccurate uint = 2
+)
+
+// Pass to SetOCRImageResize to send images to the OCR engine at full resolution
+const OCRResizeDisabled uint = 0
+
+// The passcode the API expects to be read out in a face verification video when no custom passcode is given
+const DefaultVideoPasscode = "1234"
+
+// How file and base64 inputs are sent to the Core API
+type UploadMode uint
+
+const (
+	UploadBase64    UploadMode = iota // embed files as base64 in the JSON request (default)
+	UploadMultipart                   // stream files as multipart/form-data parts, about 25% fewer bytes on the wire
+)
+
+// How a failed MRZ check digit validation is reported after a Core API scan
+type CheckDigitPolicy uint
+
+const (
+	PolicyIgnore CheckDigitPolicy = iota // don't report check digit failures
+	PolicyWarn                           // report check digit failures as a non-fatal *CheckDigitError
+	PolicyReject                         // report check digit failures as a fatal *CheckDigitError
+)
+
+// Returned alongside the scan result when the MRZ check digits failed validation and the check digit policy isn't PolicyIgnore
+// The scan result is still returned in full; use Fatal to decide whether to discard it
+type CheckDigitError struct {
+	Fatal bool
+}
+
+func (e *CheckDigitError) Error() string {
+	if e.Fatal {
+		return "MRZ check digit validation failed"
+	}
+
+	return "warning: MRZ check digit validation failed"
+}
+
 // Initialize Core API with an API key and region (US (default), EU)
-func NewCoreAPI(apiKey, region string) (CoreAPI, error) {
+// Options are applied in order after the defaults, so a fully configured client can be built in one expression
+func NewCoreAPI(apiKey, region string, opts ...CoreOption) (CoreAPI, error) {
 	if apiKey == "" {
 		return CoreAPI{}, errors.New("please provide an API key")
 	}
 
-	return CoreAPI{
-		apiKey:      apiKey,
-		apiEndpoint: endpointFromRegion(region, ""),
-		config:      defaultCoreConfig,
-	}, nil
+	client, err := newAPIClient(apiKey, region, "")
+	if err != nil {
+		return CoreAPI{}, err
+	}
+
+	c := CoreAPI{
+		apiClient: client,
+		config:    defaultCoreConfig,
+	}
+
+	for _, opt := range opts {
+		if err := opt.applyCore(&c); err != nil {
+			return CoreAPI{}, err
+		}
+	}
+
+	return c, nil
+}
+
+// Copy the client with its own configuration, so setters on the copy don't affect c or any other copy
+// The HTTP client, rate limit and usage recorder are still shared, as those are safe for concurrent use
+func (c *CoreAPI) Clone() *CoreAPI {
+	clone := *c.snapshot()
+	if c.mutex != nil {
+		clone.mutex = &sync.RWMutex{}
+	}
+
+	clone.config.contractPrefillData = make(map[string]interface{}, len(c.config.contractPrefillData))
+	for key, value := range c.config.contractPrefillData {
+		clone.config.contractPrefillData[key] = value
+	}
+
+	if c.config.typeAccuracy != nil {
+		clone.config.typeAccuracy = make(map[string]uint, len(c.config.typeAccuracy))
+		for docType, accuracy := range c.config.typeAccuracy {
+			clone.config.typeAccuracy[docType] = accuracy
+		}
+	}
+
+	return &clone
+}
+
+// OPTIONS
+
+// Configures a CoreAPI at construction time
+// Any ClientOption is also a CoreOption
+type CoreOption interface {
+	applyCore(c *CoreAPI) error
+}
+
+type coreOption func(c *CoreAPI) error
+
+func (o coreOption) applyCore(c *CoreAPI) error {
+	return o(c)
+}
+
+// Set OCR Accuracy at construction time, as with SetAccuracy
+func WithAccuracy(accuracy uint) CoreOption {
+	return coreOption(func(c *CoreAPI) error {
+		return c.SetAccuracy(accuracy)
+	})
+}
+
+// Set the maximum size of file and io.Reader inputs at construction time, as with SetMaxUploadSize
+func WithMaxUploadSize(size int64) CoreOption {
+	return coreOption(func(c *CoreAPI) error {
+		return c.SetMaxUploadSize(size)
+	})
+}
+
+// Choose how file and base64 inputs are uploaded; URL inputs are always passed to the API as URLs
+// Inputs are still read and checked up front, so UploadMultipart saves bandwidth rather than memory
+func WithUploadMode(mode UploadMode) CoreOption {
+	return coreOption(func(c *CoreAPI) error {
+		if mode != UploadBase64 && mode != UploadMultipart {
+			return errors.New("invalid upload mode")
+		}
+		c.uploadMode = mode
+
+		return nil
+	})
+}
+
+// Guard the configuration with a lock, so setters can be called while other goroutines are scanning
+// Each scan uses the configuration as it was when the scan started; Clone is usually the simpler choice
+func WithThreadSafe() CoreOption {
+	return coreOption(func(c *CoreAPI) error {
+		c.mutex = &sync.RWMutex{}
+
+		return nil
+	})
+}
+
+// Save scanned documents to the vault at construction time
+// Only the main vault switch is set; use EnableVault for the remaining vault settings
+func WithVault(enabled bool) CoreOption {
+	return coreOption(func(c *CoreAPI) error {
+		c.config.vaultSave = enabled
+
+		return nil
+	})
+}
+
+// Changes the configuration for a single scan, e.g. ScanFront(doc, WithCountryOverride("US"))
+// Overrides are applied to a private copy of the configuration, so the client and concurrent scans are unaffected
+type ScanOption func(c *CoreAPI) error
+
+// Accept documents from these countries for one scan, as with RestrictCountry
+func WithCountryOverride(countryCodes string) ScanOption {
+	return func(c *CoreAPI) error {
+		c.RestrictCountry(countryCodes)
+
+		return nil
+	}
+}
+
+// Accept documents from these states for one scan, as with RestrictState
+func WithStateOverride(states string) ScanOption {
+	return func(c *CoreAPI) error {
+		c.RestrictState(states)
+
+		return nil
+	}
+}
+
+// Accept these document types for one scan, as with RestrictType
+func WithTypeOverride(docTypes string) ScanOption {
+	return func(c *CoreAPI) error {
+		c.RestrictType(docTypes)
+
+		return nil
+	}
+}
+
+// Use this OCR accuracy for one scan, as with SetAccuracy
+func WithAccuracyOverride(accuracy uint) ScanOption {
+	return func(c *CoreAPI) error {
+		return c.SetAccuracy(accuracy)
+	}
+}
+
+// Replace the verification settings for one scan, as with SetVerifications
+func WithVerificationsOverride(verifications map[string]string) ScanOption {
+	return func(c *CoreAPI) error {
+		return c.SetVerifications(verifications)
+	}
+}
+
+// Declare the format of the document images for one scan, instead of leaving the API to detect it: "jpeg", "png" or "pdf"
+// Base64 document content is sent as a data URI of that type, and multipart uploads label the document parts with it;
+// URL inputs are passed on unchanged
+func WithImageFormat(format string) ScanOption {
+	return func(c *CoreAPI) error {
+		if _, ok := imageFormatTypes[format]; !ok {
+			return fmt.Errorf("unsupported image format %q; jpeg, png or pdf accepted", format)
+		}
+		c.imageFormat = format
+
+		return nil
+	}
+}
+
+// Let ScanAuto and ScanAutoContext scan two images again the other way round when the API reads the first as the back of the
+// document, which consumes quota for both scans
+func WithSideSwap() ScanOption {
+	return func(c *CoreAPI) error {
+		c.swapSides = true
+
+		return nil
+	}
+}
+
+// Call any setters on the copy used for one scan, for settings without a dedicated override
+func WithConfigOverride(configure func(c *CoreAPI) error) ScanOption {
+	return configure
 }
 
 // SETTERS
+//
+// Setters taking a string (VerifyName, VerifyDOB, RestrictCountry, SetAMLDatabase, etc.) clear that one setting
+// when passed an empty string, leaving the rest of the configuration untouched
 
 // Reset all API configurations except API key and region
 func (c *CoreAPI) ResetConfig() {
+	defer c.lock()()
+
 	c.config = defaultCoreConfig
 }
 
-// Set OCR Accuracy: 0 = Fast, 1 = Balanced, 2 = Accurate (default)
-func (c *CoreAPI) SetAccuracy(accuracy uint) {
+// Set a default timeout for API requests, applied whenever the request context has no deadline of its own
+// Set to 0 to disable the default timeout
+func (c *CoreAPI) SetTimeout(timeout time.Duration) {
+	defer c.lock()()
+
+	c.timeout = timeout
+}
+
+// Send requests to endpoint verbatim, instead of the endpoint chosen by region, e.g. a mock server or on-premise deployment
+// Only http and https URLs are accepted, and any trailing slash is removed
+func (c *CoreAPI) SetEndpoint(endpoint string) error {
+	defer c.lock()()
+
+	return c.setEndpoint(endpoint)
+}
+
+// Set the maximum size in bytes of each file or io.Reader input, checked before the scan is sent
+// Set to 0 to restore the default limit of 32 MiB
+// Inputs are base64-encoded as they are read, but the encoded form (about 4/3 of the input size) is still held in memory
+// until the request is sent, so keep this well within the memory available to your process
+func (c *CoreAPI) SetMaxUploadSize(size int64) error {
+	defer c.lock()()
+
+	if size < 0 {
+		return errors.New("invalid upload size; must not be negative")
+	}
+	c.maxUploadSize = size
+
+	return nil
+}
+
+// Record every scan made by this client, including detection scans made for SetAccuracyForType, in recorder
+// Set to nil to stop recording
+func (c *CoreAPI) SetUsageRecorder(recorder *UsageRecorder) {
+	defer c.lock()()
+
+	c.usage = recorder
+}
+
+// Enable test mode for development: scans are never saved to your vault, whatever EnableVault is set to
+//
+// IMPORTANT: ID Analyzer has no sandbox endpoint or test flag, so scans made in test mode are still billed against your quota
+// To exercise the full flow without any API calls at all, point the client at a mock server instead
+func (c *CoreAPI) SetTestMode(enabled bool) {
+	defer c.lock()()
+
+	c.config.testMode = enabled
+}
+
+// Set OCR Accuracy: AccuracyFast, AccuracyBalanced or AccuracyAccurate (default)
+func (c *CoreAPI) SetAccuracy(accuracy uint) error {
+	defer c.lock()()
+
+	if err := validateAccuracy(accuracy); err != nil {
+		return err
+	}
 	c.config.accuracy = accuracy
+
+	return nil
+}
+
+// Override the OCR accuracy for one document type (e.g. "P" for passport, "D" for driver license, "I" for identity card)
+// The API accepts a single accuracy per request, so once any override is set, every scan is preceded by a quick
+// detection scan (fast OCR, no vault, AML, authentication or contract) to find the document type
+// NOTE: the detection scan is billed like any other, so each scan consumes one extra quota while overrides are set
+func (c *CoreAPI) SetAccuracyForType(docType string, accuracy uint) error {
+	defer c.lock()()
+
+	if docType == "" {
+		return errors.New("document type required")
+	}
+	if err := validateAccuracy(accuracy); err != nil {
+		return err
+	}
+
+	typeAccuracy := map[string]uint{docType: accuracy}
+	for existingType, existingAccuracy := range c.config.typeAccuracy {
+		if existingType != docType {
+			typeAccuracy[existingType] = existingAccuracy
+		}
+	}
+	c.config.typeAccuracy = typeAccuracy
+
+	return nil
 }
 
 // Validate the document to check whether the document is authentic and has not been tampered, and set authentication module
-// Authentication Module can be 1, 2 or quick
+// Authentication Module can be 1, 2 or quick; Core defaults to module 1 for speed, while DocuPass defaults to the more detailed module 2
+// The module is ignored (and not validated) when authentication is disabled
 func (c *CoreAPI) EnableAuthentication(authenticate bool, authModule string) error {
+	defer c.lock()()
+
 	c.config.authenticate = authenticate
+	if !authenticate {
+		return nil
+	}
 
 	if authModule != "1" && authModule != "2" && authModule != "quick" {
 		return errors.New(`invalid authentication module; "1", "2" or "quick" accepted`)
@@ -152,10 +612,12 @@ func (c *CoreAPI) EnableAuthentication(authenticate bool, authModule string) err
 	return nil
 }
 
-// Scale down the uploaded image before sending to OCR engine
-// Adjust this value to fine tune recognition accuracy on large full-resolution images
-// Set to 0 to disable image resizing
+// Scale down the uploaded image before sending to OCR engine, so that neither its width nor its height exceeds maxScale pixels
+// Adjust this value (500 to 4000, default 2000) to fine tune recognition accuracy on large full-resolution images
+// Set to OCRResizeDisabled to disable image resizing
 func (c *CoreAPI) SetOCRImageResize(maxScale uint) error {
+	defer c.lock()()
+
 	if maxScale != 0 && (maxScale < 500 || maxScale > 4000) {
 		return errors.New("invalid scale value; 0, or 500 to 4000 accepted")
 	}
@@ -167,6 +629,8 @@ func (c *CoreAPI) SetOCRImageResize(maxScale uint) error {
 // Set the minimum confidence score to consider faces being identical
 // Value should be between 0 to 1; a higher value yields more-strict verification
 func (c *CoreAPI) SetBiometricThreshold(threshold float32) error {
+	defer c.lock()()
+
 	if threshold <= 0 || threshold > 1 {
 		return errors.New("invalid threshold value; float32 between 0 to 1 accepted")
 	}
@@ -177,6 +641,8 @@ func (c *CoreAPI) SetBiometricThreshold(threshold float32) error {
 
 // Generate cropped image of document and/or face, and set output format [url, base64]
 func (c *CoreAPI) EnableImageOutput(cropDocument, cropFace bool, outputFormat string) error {
+	defer c.lock()()
+
 	if outputFormat != "url" && outputFormat != "base64" {
 		return errors.New(`invalid output format; "url" or "base64" accepted`)
 	}
@@ -187,31 +653,59 @@ func (c *CoreAPI) EnableImageOutput(cropDocument, cropFace bool, outputFormat st
 	return nil
 }
 
+// Generate a cropped image of the document, leaving the face crop and output format set by EnableImageOutput untouched
+func (c *CoreAPI) SetCropDocument(enabled bool) {
+	defer c.lock()()
+
+	c.config.outputImage = enabled
+}
+
 // Check if the names, document number and document type matches between the front and the back of the document when performing dual-side scan
 // If any information mismatches error 14 will be thrown.
 func (c *CoreAPI) EnableDualSideCheck(enabled bool) {
+	defer c.lock()()
+
 	c.config.dualSideCheck = enabled
 }
 
+// Refuse image arguments that could be interpreted as either a URL or a local file, instead of silently treating them as URLs
+func (c *CoreAPI) EnableStrictInput(enabled bool) {
+	defer c.lock()()
+
+	c.config.strictInput = enabled
+}
+
 // Check if the document is still valid based on its expiry date
 func (c *CoreAPI) VerifyExpiry(enabled bool) {
+	defer c.lock()()
+
 	c.config.verifyExpiry = enabled
 }
 
 // Check if supplied document or personal number matches with document
 func (c *CoreAPI) VerifyDocumentNumber(documentNumber string) {
+	defer c.lock()()
+
 	c.config.verifyDocumentNo = documentNumber
 }
 
 // Check if supplied name matches with document
 func (c *CoreAPI) VerifyName(name string) {
+	defer c.lock()()
+
 	c.config.verifyName = name
 }
 
 // Check if supplied date of birth matches with document
+// Both YYYY/MM/DD and YYYY-MM-DD are accepted; the date is sent to the API as YYYY/MM/DD
 func (c *CoreAPI) VerifyDOB(dob string) error {
-	if _, err := time.Parse("2006/01/02", dob); err != nil {
-		return errors.New("invalid birthday format (YYYY/MM/DD)")
+	defer c.lock()()
+
+	if dob != "" {
+		var err error
+		if dob, err = normalizeDOB(dob); err != nil {
+			return err
+		}
 	}
 	c.config.verifyDOB = dob
 
@@ -220,7 +714,9 @@ func (c *CoreAPI) VerifyDOB(dob string) error {
 
 // Check if the document holder is aged between the given range
 func (c *CoreAPI) VerifyAge(ageRange string) error {
-	if matched, _ := regexp.MatchString(`^\d+-\d+$`, ageRange); !matched {
+	defer c.lock()()
+
+	if matched, _ := regexp.MatchString(`^\d+-\d+$`, ageRange); !matched && ageRange != "" {
 		return errors.New("invalid age range format (minAge-maxAge)")
 	}
 	c.config.verifyAge = ageRange
@@ -230,39 +726,84 @@ func (c *CoreAPI) VerifyAge(ageRange string) error {
 
 // Check if supplied address matches with document
 func (c *CoreAPI) VerifyAddress(address string) {
+	defer c.lock()()
+
 	c.config.verifyAddress = address
 }
 
 // Check if supplied postcode matches with document
 func (c *CoreAPI) VerifyPostcode(postcode string) {
+	defer c.lock()()
+
 	c.config.verifyPostcode = postcode
 }
 
+// Configure several verifications at once, for example from a config file
+// Keys are "name", "dob", "age", "address", "postcode", "documentnumber" and "expiry" (with a value of "true" or "false")
+// Each value is validated as by the matching Verify setter, and nothing changes unless every entry is valid
+func (c *CoreAPI) SetVerifications(verifications map[string]string) error {
+	defer c.lock()()
+
+	staged := c.staged()
+	err := applyVerifications(verifications, map[string]func(string) error{
+		"name":           func(value string) error { staged.VerifyName(value); return nil },
+		"dob":            staged.VerifyDOB,
+		"age":            staged.VerifyAge,
+		"address":        func(value string) error { staged.VerifyAddress(value); return nil },
+		"postcode":       func(value string) error { staged.VerifyPostcode(value); return nil },
+		"documentnumber": func(value string) error { staged.VerifyDocumentNumber(value); return nil },
+		"expiry":         func(value string) error { return verificationBool(value, staged.VerifyExpiry) },
+	})
+	if err != nil {
+		return err
+	}
+	c.config = staged.config
+
+	return nil
+}
+
 // Check if the document was issued by specified countries, if not error code 10 will be thrown
 // Separate multiple values with comma: For example "US,CA" would accept documents from United States and Canada
 func (c *CoreAPI) RestrictCountry(countryCodes string) {
+	defer c.lock()()
+
 	c.config.country = countryCodes
 }
 
 // Check if the document was issued by specified state, if not error code 11 will be thrown
 // Separate multiple values with comma: For example "CA,TX" would accept documents from California and Texas
 func (c *CoreAPI) RestrictState(states string) {
+	defer c.lock()()
+
 	c.config.region = states
 }
 
 // Check if the document was one of the specified types, if not error code 12 will be thrown
 // For example, "PD" would accept both passport and drivers license
 func (c *CoreAPI) RestrictType(docTypes string) {
+	defer c.lock()()
+
 	c.config.docType = docTypes
 }
 
 // Disable Visual OCR and read data from AAMVA Barcodes only
 func (c *CoreAPI) EnableBarcodeMode(enable bool) {
+	defer c.lock()()
+
 	c.config.barcodeMode = enable
 }
 
+// Check the document against your blocklist, i.e. vault entries marked as blocked, and fail the scan if it matches
+func (c *CoreAPI) EnableBlocklistCheck(enabled bool) {
+	defer c.lock()()
+
+	c.config.checkBlocklist = enabled
+}
+
 // Check document holder's name and document number against ID Analyzer AML Database for sanctions, crimes and PEPs
 func (c *CoreAPI) EnableAMLCheck(enable bool) {
+	defer c.lock()()
+
 	c.config.amlCheck = enable
 }
 
@@ -270,18 +811,24 @@ func (c *CoreAPI) EnableAMLCheck(enable bool) {
 // Separate each database code with comma, for example: un_sc,us_ofac
 // For full list of source databases and corresponding code visit AML API Overview
 func (c *CoreAPI) SetAMLDatabase(databases string) {
+	defer c.lock()()
+
 	c.config.amlDatabase = databases
 }
 
 // By default, entities with identical name or document number will be considered a match even though their birthday or nationality may be unknown
 // Enable this parameter to reduce false-positives by only matching entities with exact same nationality and birthday
 func (c *CoreAPI) EnableAMLStrictMatch(enable bool) {
+	defer c.lock()()
+
 	c.config.amlStrictMatch = enable
 }
 
 // Save document image and parsed information in your secured vault
 // You can list, search and update document entries in your vault through Vault API or web portal
 func (c *CoreAPI) EnableVault(enabled, saveUnrecognized, noDuplicateImage, autoMergeDocument bool) {
+	defer c.lock()()
+
 	c.config.vaultSave = enabled
 	c.config.vaultSaveUnrecognized = saveUnrecognized
 	c.config.vaultNoDuplicate = noDuplicateImage
@@ -290,6 +837,8 @@ func (c *CoreAPI) EnableVault(enabled, saveUnrecognized, noDuplicateImage, autoM
 
 // Add up to 5 custom strings that will be associated with the vault entry, this can be useful for filtering and searching entries.
 func (c *CoreAPI) SetVaultData(data1, data2, data3, data4, data5 string) {
+	defer c.lock()()
+
 	c.config.vaultCustomData1 = data1
 	c.config.vaultCustomData2 = data2
 	c.config.vaultCustomData3 = data3
@@ -297,74 +846,433 @@ func (c *CoreAPI) SetVaultData(data1, data2, data3, data4, data5 string) {
 	c.config.vaultCustomData5 = data5
 }
 
+// Set how a failed MRZ check digit validation is reported after a scan
+// PolicyIgnore (default) leaves the result as-is, PolicyWarn and PolicyReject return a *CheckDigitError alongside the result
+func (c *CoreAPI) SetCheckDigitPolicy(policy CheckDigitPolicy) error {
+	defer c.lock()()
+
+	if policy != PolicyIgnore && policy != PolicyWarn && policy != PolicyReject {
+		return errors.New("invalid check digit policy; PolicyIgnore, PolicyWarn or PolicyReject accepted")
+	}
+	c.config.checkDigitPolicy = policy
+
+	return nil
+}
+
 // Generate legal document using data from user uploaded ID
 //
 // templateId: Contract Template ID displayed under web portal
 // format: Output file format: PDF, DOCX or HTML
-// prefillData: Associative array or JSON string, to autofill dynamic fields in contract template.
-func (c *CoreAPI) GenerateContract(templateId, format string, prefillData map[string]string) error {
+// prefillData: JSON-encodable data to autofill dynamic fields in contract template
+func (c *CoreAPI) GenerateContract(templateId, format string, prefillData map[string]interface{}) error {
+	defer c.lock()()
+
 	if templateId == "" {
 		return errors.New("invalid template ID")
 	}
 	if format != "PDF" && format != "DOCX" && format != "HTML" {
 		return errors.New("invalid output file format")
 	}
+	prefill, err := validatePrefillData(prefillData)
+	if err != nil {
+		return err
+	}
 	c.config.contractGenerate = templateId
 	c.config.contractFormat = format
-	c.config.contractPrefillData = prefillData
+	c.config.contractPrefillData = prefill
 
 	return nil
 }
 
-// ACTIONS
+// Apply a configuration previously saved with ConfigJSON, validating every value as the matching setter does
+// Unknown fields, images and API keys are rejected, and nothing changes unless the whole configuration is valid
+// Settings that ConfigJSON doesn't include (check digit policy, strict input, test mode and per-type accuracy) are left untouched
+func (c *CoreAPI) LoadConfig(data []byte) error {
+	var config coreRequest
 
-// Scan an ID document with Core API
-func (c *CoreAPI) ScanFront(documentPrimary string) (CoreResponse1Side, error) {
-	return c.scan1Side(documentPrimary, "", "", "")
-}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
 
-// Scan an ID document with Core API; supply a face verification image
-func (c *CoreAPI) ScanFrontFace(documentPrimary, biometricPhoto string) (CoreResponse1Side, error) {
-	return c.scan1Side(documentPrimary, biometricPhoto, "", "")
+	if config.ApiKey != "" {
+		return errors.New("invalid config: API key must not be included")
+	}
+	if config.Url != "" || config.UrlBack != "" || config.FaceUrl != "" || config.VideoUrl != "" ||
+		config.FileBase64 != "" || config.FileBackBase64 != "" || config.FaceBase64 != "" || config.VideoBase64 != "" || config.Passcode != "" {
+		return errors.New("invalid config: images must not be included")
+	}
+
+	defer c.lock()()
+
+	staged := c.staged()
+	if err := staged.SetAccuracy(config.Accuracy); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if err := staged.EnableAuthentication(true, config.AuthenticateModule); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	staged.config.authenticate = config.Authenticate
+	if err := staged.SetOCRImageResize(config.OcrScaledown); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if err := staged.EnableImageOutput(config.OutputImage, config.OutputFace, config.OutputMode); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	staged.EnableDualSideCheck(config.DualSideCheck)
+	staged.VerifyExpiry(config.VerifyExpiry)
+	staged.VerifyDocumentNumber(config.VerifyDocumentNo)
+	staged.VerifyName(config.VerifyName)
+	if err := staged.VerifyDOB(config.VerifyDOB); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if err := staged.VerifyAge(config.VerifyAge); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	staged.VerifyAddress(config.VerifyAddress)
+	staged.VerifyPostcode(config.VerifyPostcode)
+	staged.RestrictCountry(config.Country)
+	staged.RestrictState(config.Region)
+	staged.RestrictType(config.DocType)
+	staged.EnableBlocklistCheck(config.CheckBlocklist)
+	staged.EnableVault(config.VaultSave, config.VaultSaveUnrecognized, config.VaultNoDuplicate, config.VaultAutoMerge)
+	staged.SetVaultData(config.VaultCustomData1, config.VaultCustomData2, config.VaultCustomData3, config.VaultCustomData4, config.VaultCustomData5)
+	staged.EnableBarcodeMode(config.BarcodeMode)
+	if err := staged.SetBiometricThreshold(config.BiometricThreshold); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	staged.EnableAMLCheck(config.AmlCheck)
+	staged.EnableAMLStrictMatch(config.AmlStrictMatch)
+	staged.SetAMLDatabase(config.AmlDatabase)
+	if config.ContractGenerate != "" {
+		if err := staged.GenerateContract(config.ContractGenerate, config.ContractFormat, config.ContractPrefillData); err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+	} else {
+		staged.config.contractGenerate = ""
+		staged.config.contractFormat = ""
+		staged.config.contractPrefillData = map[string]interface{}{}
+	}
+
+	c.config = staged.config
+
+	return nil
 }
 
-// Scan an ID document with Core API; supply a face verification video
-func (c *CoreAPI) ScanFrontVideo(documentPrimary, biometricVideo string) (CoreResponse1Side, error) {
-	return c.scan1Side(documentPrimary, "", biometricVideo, "")
+// ACTIONS
+
+// Get the JSON request that the current configuration would send with each scan, without any images
+// The API key is left blank, so the output is safe to log, diff or store
+func (c *CoreAPI) ConfigJSON() ([]byte, error) {
+	c = c.snapshot()
+	payload := c.requestFromConfig()
+	payload.ApiKey = ""
+
+	return json.Marshal(payload)
 }
 
-// Scan an ID document with Core API; supply a face verification video and video passcode
-func (c *CoreAPI) ScanFrontVideoCustomPasscode(documentPrimary, biometricVideo, biometricVideoPasscode string) (CoreResponse1Side, error) {
-	return c.scan1Side(documentPrimary, "", biometricVideo, biometricVideoPasscode)
+// Scan an ID document with Core API
+func (c *CoreAPI) ScanFront(documentPrimary string, opts ...ScanOption) (CoreResponse1Side, error) {
+	return c.ScanFrontContext(context.Background(), documentPrimary, opts...)
 }
 
-// Scan both sides of an ID document with Core API
-func (c *CoreAPI) ScanBoth(documentPrimary, documentSecondary string) (CoreResponse2Sides, error) {
-	return c.scan2Sides(documentPrimary, documentSecondary, "", "", "")
+// Scan an ID document with Core API, bounded by ctx
+func (c *CoreAPI) ScanFrontContext(ctx context.Context, documentPrimary string, opts ...ScanOption) (CoreResponse1Side, error) {
+	return c.scan1Side(ctx, documentPrimary, "", "", "", opts...)
 }
 
-// Scan both sides of an ID document with Core API; supply a face verification image
-func (c *CoreAPI) ScanBothFace(documentPrimary, documentSecondary, biometricPhoto string) (CoreResponse2Sides, error) {
-	return c.scan2Sides(documentPrimary, documentSecondary, biometricPhoto, "", "")
+// Scan an ID document with Core API; supply a face verification image
+func (c *CoreAPI) ScanFrontFace(documentPrimary, biometricPhoto string, opts ...ScanOption) (CoreResponse1Side, error) {
+	return c.ScanFrontFaceContext(context.Background(), documentPrimary, biometricPhoto, opts...)
 }
 
-// Scan both sides of an ID document with Core API; supply a face verification video
-func (c *CoreAPI) ScanBothVideo(documentPrimary, documentSecondary, biometricVideo string) (CoreResponse2Sides, error) {
-	return c.scan2Sides(documentPrimary, documentSecondary, "", biometricVideo, "")
+// Scan an ID document with Core API; supply a face verification image, bounded by ctx
+func (c *CoreAPI) ScanFrontFaceContext(ctx context.Context, documentPrimary, biometricPhoto string, opts ...ScanOption) (CoreResponse1Side, error) {
+	return c.scan1Side(ctx, documentPrimary, biometricPhoto, "", "", opts...)
 }
 
-// Scan both sides of an ID document with Core API; supply a face verification video and video passcode
-func (c *CoreAPI) ScanBothVideoCustomPasscode(documentPrimary, documentSecondary, biometricVideo, biometricVideoPasscode string) (CoreResponse2Sides, error) {
-	return c.scan2Sides(documentPrimary, documentSecondary, "", biometricVideo, biometricVideoPasscode)
+// Largest face image, in pixels, ScanFrontFaceImage will encode; a face photo never needs more, and encoding costs time and memory
+const maxFaceImagePixels int64 = 40000000
+
+// Scan an ID document with Core API; supply a decoded face verification image, which is JPEG-encoded before it is sent
+// Images over 40 megapixels are refused before encoding, and the encoded image counts against the SetMaxUploadSize limit
+// like any other upload
+func (c *CoreAPI) ScanFrontFaceImage(documentPrimary string, face image.Image, opts ...ScanOption) (CoreResponse1Side, error) {
+	return c.ScanFrontFaceImageContext(context.Background(), documentPrimary, face, opts...)
 }
 
-// PRIVATE
+// Scan an ID document with Core API; supply a decoded face verification image, bounded by ctx
+func (c *CoreAPI) ScanFrontFaceImageContext(ctx context.Context, documentPrimary string, face image.Image, opts ...ScanOption) (CoreResponse1Side, error) {
+	if face == nil || face.Bounds().Empty() {
+		return CoreResponse1Side{}, errors.New("face image required")
+	}
+	if size := face.Bounds().Size(); int64(size.X)*int64(size.Y) > maxFaceImagePixels {
+		return CoreResponse1Side{}, fmt.Errorf("face image is %dx%d pixels, over the %d pixel limit", size.X, size.Y, maxFaceImagePixels)
+	}
 
-type coreConfig struct {
-	accuracy              uint
-	authenticate          bool
-	authenticateModule    string
-	ocrScaledown          uint
+	c, err := c.withOverrides(opts)
+	if err != nil {
+		return CoreResponse1Side{}, err
+	}
+
+	primary, _, _, _, err := c.detectInputs(documentPrimary, "", "", "")
+	if err != nil {
+		return CoreResponse1Side{}, err
+	}
+
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, face, &jpeg.Options{Quality: 90}); err != nil {
+		return CoreResponse1Side{}, fmt.Errorf("failed to encode face image: %s", err.Error())
+	}
+
+	return c.scanInput1Side(ctx, primary, BytesInput(encoded.Bytes()), nil, "")
+}
+
+// Scan an ID document with Core API; supply a face verification video
+// The person in the video should read out DefaultVideoPasscode; use ScanFrontVideoCustomPasscode to choose another
+func (c *CoreAPI) ScanFrontVideo(documentPrimary, biometricVideo string, opts ...ScanOption) (CoreResponse1Side, error) {
+	return c.ScanFrontVideoContext(context.Background(), documentPrimary, biometricVideo, opts...)
+}
+
+// Scan an ID document with Core API; supply a face verification video, bounded by ctx
+func (c *CoreAPI) ScanFrontVideoContext(ctx context.Context, documentPrimary, biometricVideo string, opts ...ScanOption) (CoreResponse1Side, error) {
+	return c.scan1Side(ctx, documentPrimary, "", biometricVideo, DefaultVideoPasscode, opts...)
+}
+
+// Scan an ID document with Core API; supply a face verification video and video passcode
+func (c *CoreAPI) ScanFrontVideoCustomPasscode(documentPrimary, biometricVideo, biometricVideoPasscode string, opts ...ScanOption) (CoreResponse1Side, error) {
+	return c.ScanFrontVideoCustomPasscodeContext(context.Background(), documentPrimary, biometricVideo, biometricVideoPasscode, opts...)
+}
+
+// Scan an ID document with Core API; supply a face verification video and video passcode, bounded by ctx
+func (c *CoreAPI) ScanFrontVideoCustomPasscodeContext(ctx context.Context, documentPrimary, biometricVideo, biometricVideoPasscode string, opts ...ScanOption) (CoreResponse1Side, error) {
+	return c.scan1Side(ctx, documentPrimary, "", biometricVideo, biometricVideoPasscode, opts...)
+}
+
+// Scan both sides of an ID document with Core API
+func (c *CoreAPI) ScanBoth(documentPrimary, documentSecondary string, opts ...ScanOption) (CoreResponse2Sides, error) {
+	return c.ScanBothContext(context.Background(), documentPrimary, documentSecondary, opts...)
+}
+
+// Scan both sides of an ID document with Core API, bounded by ctx
+func (c *CoreAPI) ScanBothContext(ctx context.Context, documentPrimary, documentSecondary string, opts ...ScanOption) (CoreResponse2Sides, error) {
+	return c.scan2Sides(ctx, documentPrimary, documentSecondary, "", "", "", opts...)
+}
+
+// Scan both sides of an ID document with Core API; supply a face verification image
+func (c *CoreAPI) ScanBothFace(documentPrimary, documentSecondary, biometricPhoto string, opts ...ScanOption) (CoreResponse2Sides, error) {
+	return c.ScanBothFaceContext(context.Background(), documentPrimary, documentSecondary, biometricPhoto, opts...)
+}
+
+// Scan both sides of an ID document with Core API; supply a face verification image, bounded by ctx
+func (c *CoreAPI) ScanBothFaceContext(ctx context.Context, documentPrimary, documentSecondary, biometricPhoto string, opts ...ScanOption) (CoreResponse2Sides, error) {
+	return c.scan2Sides(ctx, documentPrimary, documentSecondary, biometricPhoto, "", "", opts...)
+}
+
+// Scan both sides of an ID document with Core API; supply a face verification video
+// The person in the video should read out DefaultVideoPasscode; use ScanBothVideoCustomPasscode to choose another
+func (c *CoreAPI) ScanBothVideo(documentPrimary, documentSecondary, biometricVideo string, opts ...ScanOption) (CoreResponse2Sides, error) {
+	return c.ScanBothVideoContext(context.Background(), documentPrimary, documentSecondary, biometricVideo, opts...)
+}
+
+// Scan both sides of an ID document with Core API; supply a face verification video, bounded by ctx
+func (c *CoreAPI) ScanBothVideoContext(ctx context.Context, documentPrimary, documentSecondary, biometricVideo string, opts ...ScanOption) (CoreResponse2Sides, error) {
+	return c.scan2Sides(ctx, documentPrimary, documentSecondary, "", biometricVideo, DefaultVideoPasscode, opts...)
+}
+
+// Scan both sides of an ID document with Core API; supply a face verification video and video passcode
+func (c *CoreAPI) ScanBothVideoCustomPasscode(documentPrimary, documentSecondary, biometricVideo, biometricVideoPasscode string, opts ...ScanOption) (CoreResponse2Sides, error) {
+	return c.ScanBothVideoCustomPasscodeContext(context.Background(), documentPrimary, documentSecondary, biometricVideo, biometricVideoPasscode, opts...)
+}
+
+// Scan both sides of an ID document with Core API; supply a face verification video and video passcode, bounded by ctx
+func (c *CoreAPI) ScanBothVideoCustomPasscodeContext(ctx context.Context, documentPrimary, documentSecondary, biometricVideo, biometricVideoPasscode string, opts ...ScanOption) (CoreResponse2Sides, error) {
+	return c.scan2Sides(ctx, documentPrimary, documentSecondary, "", biometricVideo, biometricVideoPasscode, opts...)
+}
+
+// Scan an ID document with Core API, with every input given explicitly rather than detected from a string
+// biometricPhoto and biometricVideo may be nil; biometricVideoPasscode is only used with biometricVideo
+func (c *CoreAPI) ScanFrontInput(ctx context.Context, documentPrimary, biometricPhoto, biometricVideo ImageInput, biometricVideoPasscode string, opts ...ScanOption) (CoreResponse1Side, error) {
+	return c.scanInput1Side(ctx, documentPrimary, biometricPhoto, biometricVideo, biometricVideoPasscode, opts...)
+}
+
+// Scan both sides of an ID document with Core API, with every input given explicitly rather than detected from a string
+// biometricPhoto and biometricVideo may be nil; biometricVideoPasscode is only used with biometricVideo
+func (c *CoreAPI) ScanBothInput(ctx context.Context, documentPrimary, documentSecondary, biometricPhoto, biometricVideo ImageInput, biometricVideoPasscode string, opts ...ScanOption) (CoreResponse2Sides, error) {
+	return c.scanInput2Sides(ctx, documentPrimary, documentSecondary, biometricPhoto, biometricVideo, biometricVideoPasscode, opts...)
+}
+
+// Scan one or two images of an ID document without knowing which is the front
+// A single image is scanned as with ScanFront; two are scanned once as with ScanBoth, and BothSides.Result.DocumentSide
+// reports "BACK" if the API read the first image as the back; pass WithSideSwap to rescan in that case
+func (c *CoreAPI) ScanAuto(images []string, opts ...ScanOption) (CoreAutoResponse, error) {
+	return c.ScanAutoContext(context.Background(), images, opts...)
+}
+
+// Scan one or two images of an ID document without knowing which is the front, bounded by ctx
+func (c *CoreAPI) ScanAutoContext(ctx context.Context, images []string, opts ...ScanOption) (CoreAutoResponse, error) {
+	switch len(images) {
+	case 1:
+		result, err := c.ScanFrontContext(ctx, images[0], opts...)
+		return CoreAutoResponse{OneSide: &result}, err
+	case 2:
+		c, err := c.withOverrides(opts)
+		if err != nil {
+			return CoreAutoResponse{}, err
+		}
+
+		result, err := c.ScanBothContext(ctx, images[0], images[1])
+		if err == nil && c.swapSides && result.Result != nil && result.Result.DocumentSide == "BACK" {
+			result, err = c.ScanBothContext(ctx, images[1], images[0])
+		}
+		return CoreAutoResponse{BothSides: &result}, err
+	default:
+		return CoreAutoResponse{}, errors.New("one or two document images required")
+	}
+}
+
+// Scan many ID documents with up to concurrency scans in flight at once, returning results in the same order as inputs
+// One failed scan doesn't stop the others: failures are collected in a *BatchError keyed by input index
+// Scans go through any rate limit set with WithRateLimit, and scans not yet started when ctx is done fail with ctx.Err()
+func (c *CoreAPI) ScanBatch(ctx context.Context, inputs []string, concurrency int, opts ...ScanOption) ([]CoreResponse1Side, error) {
+	results := make([]CoreResponse1Side, len(inputs))
+	err := runBatch(ctx, len(inputs), concurrency, func(index int) (err error) {
+		results[index], err = c.ScanFrontContext(ctx, inputs[index], opts...)
+		return err
+	})
+
+	return results, err
+}
+
+// Scan an ID document read from fsys with Core API
+func (c *CoreAPI) ScanFrontFS(fsys fs.FS, documentPrimary string, opts ...ScanOption) (CoreResponse1Side, error) {
+	return c.ScanFrontFSContext(context.Background(), fsys, documentPrimary, opts...)
+}
+
+// Scan an ID document read from fsys with Core API, bounded by ctx
+func (c *CoreAPI) ScanFrontFSContext(ctx context.Context, fsys fs.FS, documentPrimary string, opts ...ScanOption) (CoreResponse1Side, error) {
+	return c.scanInput1Side(ctx, fsInput(fsys, documentPrimary), nil, nil, "", opts...)
+}
+
+// Scan an ID document read from fsys with Core API; supply a face verification image, also read from fsys
+func (c *CoreAPI) ScanFrontFaceFS(fsys fs.FS, documentPrimary, biometricPhoto string, opts ...ScanOption) (CoreResponse1Side, error) {
+	return c.ScanFrontFaceFSContext(context.Background(), fsys, documentPrimary, biometricPhoto, opts...)
+}
+
+// Scan an ID document read from fsys with Core API; supply a face verification image, also read from fsys, bounded by ctx
+func (c *CoreAPI) ScanFrontFaceFSContext(ctx context.Context, fsys fs.FS, documentPrimary, biometricPhoto string, opts ...ScanOption) (CoreResponse1Side, error) {
+	return c.scanInput1Side(ctx, fsInput(fsys, documentPrimary), fsInput(fsys, biometricPhoto), nil, "", opts...)
+}
+
+// Scan both sides of an ID document read from fsys with Core API
+func (c *CoreAPI) ScanBothFS(fsys fs.FS, documentPrimary, documentSecondary string, opts ...ScanOption) (CoreResponse2Sides, error) {
+	return c.ScanBothFSContext(context.Background(), fsys, documentPrimary, documentSecondary, opts...)
+}
+
+// Scan both sides of an ID document read from fsys with Core API, bounded by ctx
+func (c *CoreAPI) ScanBothFSContext(ctx context.Context, fsys fs.FS, documentPrimary, documentSecondary string, opts ...ScanOption) (CoreResponse2Sides, error) {
+	return c.scanInput2Sides(ctx, fsInput(fsys, documentPrimary), fsInput(fsys, documentSecondary), nil, nil, "", opts...)
+}
+
+// Scan both sides of an ID document read from fsys with Core API; supply a face verification image, also read from fsys
+func (c *CoreAPI) ScanBothFaceFS(fsys fs.FS, documentPrimary, documentSecondary, biometricPhoto string, opts ...ScanOption) (CoreResponse2Sides, error) {
+	return c.ScanBothFaceFSContext(context.Background(), fsys, documentPrimary, documentSecondary, biometricPhoto, opts...)
+}
+
+// Scan both sides of an ID document read from fsys with Core API; supply a face verification image, also read from fsys, bounded by ctx
+func (c *CoreAPI) ScanBothFaceFSContext(ctx context.Context, fsys fs.FS, documentPrimary, documentSecondary, biometricPhoto string, opts ...ScanOption) (CoreResponse2Sides, error) {
+	return c.scanInput2Sides(ctx, fsInput(fsys, documentPrimary), fsInput(fsys, documentSecondary), fsInput(fsys, biometricPhoto), nil, "", opts...)
+}
+
+// Scan an ID document read from documentPrimary with Core API
+func (c *CoreAPI) ScanFrontReader(documentPrimary io.Reader, opts ...ScanOption) (CoreResponse1Side, error) {
+	return c.ScanFrontReaderContext(context.Background(), documentPrimary, opts...)
+}
+
+// Scan an ID document read from documentPrimary with Core API, bounded by ctx
+func (c *CoreAPI) ScanFrontReaderContext(ctx context.Context, documentPrimary io.Reader, opts ...ScanOption) (CoreResponse1Side, error) {
+	return c.scanInput1Side(ctx, readerInput(documentPrimary), nil, nil, "", opts...)
+}
+
+// Scan an ID document read from documentPrimary with Core API; supply a face verification image read from biometricPhoto
+func (c *CoreAPI) ScanFrontFaceReader(documentPrimary, biometricPhoto io.Reader, opts ...ScanOption) (CoreResponse1Side, error) {
+	return c.ScanFrontFaceReaderContext(context.Background(), documentPrimary, biometricPhoto, opts...)
+}
+
+// Scan an ID document read from documentPrimary with Core API; supply a face verification image read from biometricPhoto, bounded by ctx
+func (c *CoreAPI) ScanFrontFaceReaderContext(ctx context.Context, documentPrimary, biometricPhoto io.Reader, opts ...ScanOption) (CoreResponse1Side, error) {
+	return c.scanInput1Side(ctx, readerInput(documentPrimary), readerInput(biometricPhoto), nil, "", opts...)
+}
+
+// Scan an ID document read from documentPrimary with Core API; supply a face verification video read from biometricVideo, and its passcode
+func (c *CoreAPI) ScanFrontVideoReader(documentPrimary, biometricVideo io.Reader, biometricVideoPasscode string, opts ...ScanOption) (CoreResponse1Side, error) {
+	return c.ScanFrontVideoReaderContext(context.Background(), documentPrimary, biometricVideo, biometricVideoPasscode, opts...)
+}
+
+// Scan an ID document read from documentPrimary with Core API; supply a face verification video read from biometricVideo, and its passcode, bounded by ctx
+func (c *CoreAPI) ScanFrontVideoReaderContext(ctx context.Context, documentPrimary, biometricVideo io.Reader, biometricVideoPasscode string, opts ...ScanOption) (CoreResponse1Side, error) {
+	return c.scanInput1Side(ctx, readerInput(documentPrimary), nil, readerInput(biometricVideo), biometricVideoPasscode, opts...)
+}
+
+// Scan both sides of an ID document, read from documentPrimary and documentSecondary, with Core API
+func (c *CoreAPI) ScanBothReader(documentPrimary, documentSecondary io.Reader, opts ...ScanOption) (CoreResponse2Sides, error) {
+	return c.ScanBothReaderContext(context.Background(), documentPrimary, documentSecondary, opts...)
+}
+
+// Scan both sides of an ID document, read from documentPrimary and documentSecondary, with Core API, bounded by ctx
+func (c *CoreAPI) ScanBothReaderContext(ctx context.Context, documentPrimary, documentSecondary io.Reader, opts ...ScanOption) (CoreResponse2Sides, error) {
+	return c.scanInput2Sides(ctx, readerInput(documentPrimary), readerInput(documentSecondary), nil, nil, "", opts...)
+}
+
+// Scan both sides of an ID document, read from documentPrimary and documentSecondary, with Core API; supply a face verification image read from biometricPhoto
+func (c *CoreAPI) ScanBothFaceReader(documentPrimary, documentSecondary, biometricPhoto io.Reader, opts ...ScanOption) (CoreResponse2Sides, error) {
+	return c.ScanBothFaceReaderContext(context.Background(), documentPrimary, documentSecondary, biometricPhoto, opts...)
+}
+
+// Scan both sides of an ID document, read from documentPrimary and documentSecondary, with Core API; supply a face verification image read from biometricPhoto, bounded by ctx
+func (c *CoreAPI) ScanBothFaceReaderContext(ctx context.Context, documentPrimary, documentSecondary, biometricPhoto io.Reader, opts ...ScanOption) (CoreResponse2Sides, error) {
+	return c.scanInput2Sides(ctx, readerInput(documentPrimary), readerInput(documentSecondary), readerInput(biometricPhoto), nil, "", opts...)
+}
+
+// Scan an ID document, supplied as raw image data (JPG, PNG or PDF), with Core API
+func (c *CoreAPI) ScanFrontBytes(documentPrimary []byte, opts ...ScanOption) (CoreResponse1Side, error) {
+	return c.ScanFrontBytesContext(context.Background(), documentPrimary, opts...)
+}
+
+// Scan an ID document, supplied as raw image data (JPG, PNG or PDF), with Core API, bounded by ctx
+func (c *CoreAPI) ScanFrontBytesContext(ctx context.Context, documentPrimary []byte, opts ...ScanOption) (CoreResponse1Side, error) {
+	if err := checkImageFormat(documentPrimary); err != nil {
+		return CoreResponse1Side{}, fmt.Errorf("invalid primary document image: %s", err.Error())
+	}
+
+	return c.scanInput1Side(ctx, BytesInput(documentPrimary), nil, nil, "", opts...)
+}
+
+// Scan both sides of an ID document, supplied as raw image data (JPG, PNG or PDF), with Core API
+func (c *CoreAPI) ScanBothBytes(documentPrimary, documentSecondary []byte, opts ...ScanOption) (CoreResponse2Sides, error) {
+	return c.ScanBothBytesContext(context.Background(), documentPrimary, documentSecondary, opts...)
+}
+
+// Scan both sides of an ID document, supplied as raw image data (JPG, PNG or PDF), with Core API, bounded by ctx
+func (c *CoreAPI) ScanBothBytesContext(ctx context.Context, documentPrimary, documentSecondary []byte, opts ...ScanOption) (CoreResponse2Sides, error) {
+	if err := checkImageFormat(documentPrimary); err != nil {
+		return CoreResponse2Sides{}, fmt.Errorf("invalid primary document image: %s", err.Error())
+	}
+	if err := checkImageFormat(documentSecondary); err != nil {
+		return CoreResponse2Sides{}, fmt.Errorf("invalid secondary document image: %s", err.Error())
+	}
+
+	return c.scanInput2Sides(ctx, BytesInput(documentPrimary), BytesInput(documentSecondary), nil, nil, "", opts...)
+}
+
+// PRIVATE
+
+type coreConfig struct {
+	accuracy              uint
+	authenticate          bool
+	authenticateModule    string
+	ocrScaledown          uint
 	outputImage           bool
 	outputFace            bool
 	outputMode            string
@@ -396,141 +1304,311 @@ type coreConfig struct {
 	amlDatabase           string
 	contractGenerate      string
 	contractFormat        string
-	contractPrefillData   map[string]string
-	client                string
+	contractPrefillData   map[string]interface{}
+	checkDigitPolicy      CheckDigitPolicy
+	strictInput           bool
+	testMode              bool
+	typeAccuracy          map[string]uint
 }
 
 type coreRequest struct {
-	ApiKey                string            `json:"apikey"`
-	Url                   string            `json:"url"`
-	UrlBack               string            `json:"url_back"`
-	FaceUrl               string            `json:"faceurl"`
-	VideoUrl              string            `json:"videourl"`
-	FileBase64            string            `json:"file_base64"`
-	FileBackBase64        string            `json:"file_back_base64"`
-	FaceBase64            string            `json:"face_base64"`
-	VideoBase64           string            `json:"video_base64"`
-	Passcode              string            `json:"passcode"`
-	Accuracy              uint              `json:"accuracy"`
-	Authenticate          bool              `json:"authenticate"`
-	AuthenticateModule    string            `json:"authenticate_module"`
-	OcrScaledown          uint              `json:"ocr_scaledown"`
-	OutputImage           bool              `json:"outputimage"`
-	OutputFace            bool              `json:"outputface"`
-	OutputMode            string            `json:"outputmode"`
-	DualSideCheck         bool              `json:"dualsidecheck"`
-	VerifyExpiry          bool              `json:"verify_expiry"`
-	VerifyDocumentNo      string            `json:"verify_documentno"`
-	VerifyName            string            `json:"verify_name"`
-	VerifyDOB             string            `json:"verify_dob"`
-	VerifyAge             string            `json:"verify_age"`
-	VerifyAddress         string            `json:"verify_address"`
-	VerifyPostcode        string            `json:"verify_postcode"`
-	Country               string            `json:"country"`
-	Region                string            `json:"region"`
-	DocType               string            `json:"type"`
-	CheckBlocklist        bool              `json:"checkblocklist"`
-	VaultSave             bool              `json:"vault_save"`
-	VaultSaveUnrecognized bool              `json:"vault_saveunrecognized"`
-	VaultNoDuplicate      bool              `json:"vault_noduplicate"`
-	VaultAutoMerge        bool              `json:"vault_automerge"`
-	VaultCustomData1      string            `json:"vault_customdata1"`
-	VaultCustomData2      string            `json:"vault_customdata2"`
-	VaultCustomData3      string            `json:"vault_customdata3"`
-	VaultCustomData4      string            `json:"vault_customdata4"`
-	VaultCustomData5      string            `json:"vault_customdata5"`
-	BarcodeMode           bool              `json:"barcodemode"`
-	BiometricThreshold    float32           `json:"biometric_threshold"`
-	AmlCheck              bool              `json:"aml_check"`
-	AmlStrictMatch        bool              `json:"aml_strict_match"`
-	AmlDatabase           string            `json:"aml_database"`
-	ContractGenerate      string            `json:"contract_generate"`
-	ContractFormat        string            `json:"contract_format"`
-	ContractPrefillData   map[string]string `json:"contract_prefill_data"`
-	Client                string            `json:"client"`
+	ApiKey                string                 `json:"apikey"`
+	Url                   string                 `json:"url"`
+	UrlBack               string                 `json:"url_back"`
+	FaceUrl               string                 `json:"faceurl"`
+	VideoUrl              string                 `json:"videourl"`
+	FileBase64            string                 `json:"file_base64"`
+	FileBackBase64        string                 `json:"file_back_base64"`
+	FaceBase64            string                 `json:"face_base64"`
+	VideoBase64           string                 `json:"video_base64"`
+	Passcode              string                 `json:"passcode"`
+	Accuracy              uint                   `json:"accuracy"`
+	Authenticate          bool                   `json:"authenticate"`
+	AuthenticateModule    string                 `json:"authenticate_module"`
+	OcrScaledown          uint                   `json:"ocr_scaledown"`
+	OutputImage           bool                   `json:"outputimage"`
+	OutputFace            bool                   `json:"outputface"`
+	OutputMode            string                 `json:"outputmode"`
+	DualSideCheck         bool                   `json:"dualsidecheck"`
+	VerifyExpiry          bool                   `json:"verify_expiry"`
+	VerifyDocumentNo      string                 `json:"verify_documentno"`
+	VerifyName            string                 `json:"verify_name"`
+	VerifyDOB             string                 `json:"verify_dob"`
+	VerifyAge             string                 `json:"verify_age"`
+	VerifyAddress         string                 `json:"verify_address"`
+	VerifyPostcode        string                 `json:"verify_postcode"`
+	Country               string                 `json:"country"`
+	Region                string                 `json:"region"`
+	DocType               string                 `json:"type"`
+	CheckBlocklist        bool                   `json:"checkblocklist"`
+	VaultSave             bool                   `json:"vault_save"`
+	VaultSaveUnrecognized bool                   `json:"vault_saveunrecognized"`
+	VaultNoDuplicate      bool                   `json:"vault_noduplicate"`
+	VaultAutoMerge        bool                   `json:"vault_automerge"`
+	VaultCustomData1      string                 `json:"vault_customdata1"`
+	VaultCustomData2      string                 `json:"vault_customdata2"`
+	VaultCustomData3      string                 `json:"vault_customdata3"`
+	VaultCustomData4      string                 `json:"vault_customdata4"`
+	VaultCustomData5      string                 `json:"vault_customdata5"`
+	BarcodeMode           bool                   `json:"barcodemode"`
+	BiometricThreshold    float32                `json:"biometric_threshold"`
+	AmlCheck              bool                   `json:"aml_check"`
+	AmlStrictMatch        bool                   `json:"aml_strict_match"`
+	AmlDatabase           string                 `json:"aml_database"`
+	ContractGenerate      string                 `json:"contract_generate"`
+	ContractFormat        string                 `json:"contract_format"`
+	ContractPrefillData   map[string]interface{} `json:"contract_prefill_data"`
+	Client                string                 `json:"client"`
 }
 
 var defaultCoreConfig = coreConfig{
-	accuracy:              2,                   // high accuracy
-	authenticate:          false,               // no auth
-	authenticateModule:    "1",                 // moderate detail
-	ocrScaledown:          2000,                // 2000 DPI
-	outputImage:           false,               // don't output the card side(s)
-	outputFace:            false,               // don't output the cropped face
-	outputMode:            "url",               // outputs as URLs
-	dualSideCheck:         false,               // only check front
-	verifyExpiry:          true,                // verify expiration date
-	verifyDocumentNo:      "",                  // don't check against specific value
-	verifyName:            "",                  // don't check against specific value
-	verifyDOB:             "",                  // don't check against specific value
-	verifyAge:             "",                  // don't check against specific value
-	verifyAddress:         "",                  // don't check against specific value
-	verifyPostcode:        "",                  // don't check against specific value
-	country:               "",                  // don't check against specific value
-	region:                "",                  // don't check against specific value
-	docType:               "",                  // don't check against specific value
-	checkBlocklist:        false,               // don't check whether the ID is blocked
-	vaultSave:             true,                // save image(s) in vault
-	vaultSaveUnrecognized: false,               // don't save unrecognized image(s)
-	vaultNoDuplicate:      false,               // save duplicates
-	vaultAutoMerge:        false,               // don't collate duplicates
-	vaultCustomData1:      "",                  // empty / unused
-	vaultCustomData2:      "",                  // empty / unused
-	vaultCustomData3:      "",                  // empty / unused
-	vaultCustomData4:      "",                  // empty / unused
-	vaultCustomData5:      "",                  // empty / unused
-	barcodeMode:           false,               // check OCR as well as barcode
-	biometricThreshold:    0.4,                 // succeed at 40% biometric confidence or higher
-	amlCheck:              false,               // don't check AML
-	amlStrictMatch:        false,               // loose AML match
-	amlDatabase:           "",                  // no AML database set
-	contractGenerate:      "",                  // don't generate contract
-	contractFormat:        "",                  // no format set
-	contractPrefillData:   map[string]string{}, // no prefilled data
-	client:                "go-sdk",            // this request is coming from the Go SDK!
-}
-
-func (c *CoreAPI) scan1Side(documentPrimary, biometricPhoto, biometricVideo, biometricVideoPasscode string) (CoreResponse1Side, error) {
-	var result CoreResponse1Side
+	accuracy:              AccuracyAccurate,         // high accuracy
+	authenticate:          false,                    // no auth
+	authenticateModule:    "1",                      // moderate detail
+	ocrScaledown:          2000,                     // 2000 pixels
+	outputImage:           false,                    // don't output the card side(s)
+	outputFace:            false,                    // don't output the cropped face
+	outputMode:            "url",                    // outputs as URLs
+	dualSideCheck:         false,                    // only check front
+	verifyExpiry:          true,                     // verify expiration date
+	verifyDocumentNo:      "",                       // don't check against specific value
+	verifyName:            "",                       // don't check against specific value
+	verifyDOB:             "",                       // don't check against specific value
+	verifyAge:             "",                       // don't check against specific value
+	verifyAddress:         "",                       // don't check against specific value
+	verifyPostcode:        "",                       // don't check against specific value
+	country:               "",                       // don't check against specific value
+	region:                "",                       // don't check against specific value
+	docType:               "",                       // don't check against specific value
+	checkBlocklist:        false,                    // don't check whether the ID is blocked
+	vaultSave:             true,                     // save image(s) in vault
+	vaultSaveUnrecognized: false,                    // don't save unrecognized image(s)
+	vaultNoDuplicate:      false,                    // save duplicates
+	vaultAutoMerge:        false,                    // don't collate duplicates
+	vaultCustomData1:      "",                       // empty / unused
+	vaultCustomData2:      "",                       // empty / unused
+	vaultCustomData3:      "",                       // empty / unused
+	vaultCustomData4:      "",                       // empty / unused
+	vaultCustomData5:      "",                       // empty / unused
+	barcodeMode:           false,                    // check OCR as well as barcode
+	biometricThreshold:    0.4,                      // succeed at 40% biometric confidence or higher
+	amlCheck:              false,                    // don't check AML
+	amlStrictMatch:        false,                    // loose AML match
+	amlDatabase:           "",                       // no AML database set
+	contractGenerate:      "",                       // don't generate contract
+	contractFormat:        "",                       // no format set
+	contractPrefillData:   map[string]interface{}{}, // no prefilled data
+	checkDigitPolicy:      PolicyIgnore,             // don't report check digit failures
+	strictInput:           false,                    // resolve ambiguous inputs as URLs
+	testMode:              false,                    // production mode
+	typeAccuracy:          nil,                      // same accuracy for every document type
+}
+
+// MIME types of the formats accepted by WithImageFormat
+var imageFormatTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"pdf":  "application/pdf",
+}
+
+// Field indices of CoreConfidence by JSON name
+var coreConfidenceFields = func() map[string]int {
+	fields := map[string]int{}
 
-	response, err := c.scan(documentPrimary, "", biometricPhoto, biometricVideo, biometricVideoPasscode)
+	confidenceType := reflect.TypeOf(CoreConfidence{})
+	for i := 0; i < confidenceType.NumField(); i++ {
+		fields[confidenceType.Field(i).Tag.Get("json")] = i
+	}
+
+	return fields
+}()
+
+func (c *CoreAPI) scan1Side(ctx context.Context, documentPrimary, biometricPhoto, biometricVideo, biometricVideoPasscode string, opts ...ScanOption) (CoreResponse1Side, error) {
+	c, err := c.withOverrides(opts)
 	if err != nil {
 		return CoreResponse1Side{}, err
 	}
 
-	body, _ := io.ReadAll(response.Body)
-	json.Unmarshal(body, &result)
+	primary, _, photo, video, err := c.detectInputs(documentPrimary, "", biometricPhoto, biometricVideo)
+	if err != nil {
+		return CoreResponse1Side{}, err
+	}
 
-	if result.Error != nil && result.Error.Message != "" {
-		return result, fmt.Errorf("%d: %s", result.Error.Code, result.Error.Message)
+	return c.scanInput1Side(ctx, primary, photo, video, biometricVideoPasscode)
+}
+
+func (c *CoreAPI) scan2Sides(ctx context.Context, documentPrimary, documentSecondary, biometricPhoto, biometricVideo, biometricVideoPasscode string, opts ...ScanOption) (CoreResponse2Sides, error) {
+	if documentSecondary == "" {
+		return CoreResponse2Sides{}, errors.New("secondary document image required")
 	}
 
-	return result, nil
+	c, err := c.withOverrides(opts)
+	if err != nil {
+		return CoreResponse2Sides{}, err
+	}
+
+	primary, secondary, photo, video, err := c.detectInputs(documentPrimary, documentSecondary, biometricPhoto, biometricVideo)
+	if err != nil {
+		return CoreResponse2Sides{}, err
+	}
+
+	return c.scanInput2Sides(ctx, primary, secondary, photo, video, biometricVideoPasscode)
 }
 
-func (c *CoreAPI) scan2Sides(documentPrimary, documentSecondary, biometricPhoto, biometricVideo, biometricVideoPasscode string) (CoreResponse2Sides, error) {
-	var result CoreResponse2Sides
+// Every single-sided scan ends up here, whatever form its inputs were given in
+func (c *CoreAPI) scanInput1Side(ctx context.Context, documentPrimary, biometricPhoto, biometricVideo ImageInput, biometricVideoPasscode string, opts ...ScanOption) (CoreResponse1Side, error) {
+	c, err := c.withOverrides(opts)
+	if err != nil {
+		return CoreResponse1Side{}, err
+	}
 
-	if documentSecondary == "" {
+	payload, err := c.buildRequestInput(documentPrimary, nil, biometricPhoto, biometricVideo, biometricVideoPasscode)
+	if err != nil {
+		return CoreResponse1Side{}, err
+	}
+
+	return c.send1Side(ctx, payload)
+}
+
+// Every two-sided scan ends up here, whatever form its inputs were given in
+func (c *CoreAPI) scanInput2Sides(ctx context.Context, documentPrimary, documentSecondary, biometricPhoto, biometricVideo ImageInput, biometricVideoPasscode string, opts ...ScanOption) (CoreResponse2Sides, error) {
+	if documentSecondary == nil {
 		return CoreResponse2Sides{}, errors.New("secondary document image required")
 	}
 
-	response, err := c.scan(documentPrimary, documentSecondary, biometricPhoto, biometricVideo, biometricVideoPasscode)
+	c, err := c.withOverrides(opts)
+	if err != nil {
+		return CoreResponse2Sides{}, err
+	}
+
+	payload, err := c.buildRequestInput(documentPrimary, documentSecondary, biometricPhoto, biometricVideo, biometricVideoPasscode)
 	if err != nil {
 		return CoreResponse2Sides{}, err
 	}
 
-	body, _ := io.ReadAll(response.Body)
-	json.Unmarshal(body, &result)
+	return c.send2Sides(ctx, payload)
+}
+
+func (c *CoreAPI) send1Side(ctx context.Context, payload coreRequest) (CoreResponse1Side, error) {
+	var result CoreResponse1Side
+
+	ctx, cancel := withDefaultTimeout(ctx, c.timeout)
+	defer cancel()
+
+	if err := c.applyTypeAccuracy(ctx, &payload); err != nil {
+		return CoreResponse1Side{}, err
+	}
+
+	raw, err := c.postScan(ctx, payload, &result)
+	result.RawResponse = raw
+	if err != nil {
+		return result, err
+	}
+	c.recordUsage("scan", result.Quota, result.Credit)
+
+	if result.Error != nil && result.Error.Message != "" {
+		return result, result.Error
+	}
+
+	return result, c.checkDigitError(raw, result.Verification)
+}
+
+func (c *CoreAPI) send2Sides(ctx context.Context, payload coreRequest) (CoreResponse2Sides, error) {
+	var result CoreResponse2Sides
+
+	ctx, cancel := withDefaultTimeout(ctx, c.timeout)
+	defer cancel()
+
+	if err := c.applyTypeAccuracy(ctx, &payload); err != nil {
+		return CoreResponse2Sides{}, err
+	}
+
+	raw, err := c.postScan(ctx, payload, &result)
+	result.RawResponse = raw
+	if err != nil {
+		return result, err
+	}
+	c.recordUsage("scan", result.Quota, result.Credit)
 
 	if result.Error != nil && result.Error.Message != "" {
-		return result, fmt.Errorf("%d: %s", result.Error.Code, result.Error.Message)
+		return result, result.Error
 	}
 
-	return result, nil
+	return result, c.checkDigitError(raw, result.Verification)
 }
 
-func (c *CoreAPI) scan(documentPrimary, documentSecondary, biometricPhoto, biometricVideo, biometricVideoPasscode string) (*http.Response, error) {
+func validateAccuracy(accuracy uint) error {
+	if accuracy != AccuracyFast && accuracy != AccuracyBalanced && accuracy != AccuracyAccurate {
+		return errors.New("invalid accuracy; AccuracyFast, AccuracyBalanced or AccuracyAccurate accepted")
+	}
+
+	return nil
+}
+
+// Run a quick detection scan to find the document type, then use that type's accuracy override (if any) for payload
+func (c *CoreAPI) applyTypeAccuracy(ctx context.Context, payload *coreRequest) error {
+	if len(c.config.typeAccuracy) == 0 {
+		return nil
+	}
+
+	detection := *payload
+	detection.Accuracy = AccuracyFast
+	detection.Authenticate = false
+	detection.OutputImage = false
+	detection.OutputFace = false
+	detection.VaultSave = false
+	detection.VaultSaveUnrecognized = false
+	detection.AmlCheck = false
+	detection.ContractGenerate = ""
+	detection.FaceUrl, detection.FaceBase64 = "", ""
+	detection.VideoUrl, detection.VideoBase64, detection.Passcode = "", "", ""
+
+	var result struct {
+		Error  *APIError        `json:"error"`
+		Result *APIIdentityData `json:"result"`
+		Quota  uint             `json:"quota"`
+		Credit uint             `json:"credit"`
+	}
+	if _, err := c.doJSON(ctx, c.apiEndpoint, detection, &result); err != nil {
+		return err
+	}
+	c.recordUsage("detect", result.Quota, result.Credit)
+
+	if result.Error != nil && result.Error.Message != "" {
+		return result.Error
+	}
+
+	if result.Result != nil {
+		if accuracy, ok := c.config.typeAccuracy[result.Result.DocumentType]; ok {
+			payload.Accuracy = accuracy
+		}
+	}
+
+	return nil
+}
+
+func (c *CoreAPI) recordUsage(operation string, quota, credit uint) {
+	if c.usage != nil {
+		c.usage.Record(operation, quota, credit)
+	}
+}
+
+// Only a check digit result the API actually returned counts, so documents without an MRZ never fail the policy
+func (c *CoreAPI) checkDigitError(raw []byte, verification *APIVerificationData) error {
+	if c.config.checkDigitPolicy == PolicyIgnore || verification == nil {
+		return nil
+	}
+
+	for _, check := range failedVerificationChecks(raw, verification) {
+		if check == "checkdigit" {
+			return &CheckDigitError{Fatal: c.config.checkDigitPolicy == PolicyReject}
+		}
+	}
+
+	return nil
+}
+
+func (c *CoreAPI) requestFromConfig() coreRequest {
 	payload := coreRequest{
 		ApiKey:                c.apiKey,
 		Accuracy:              c.config.accuracy,
@@ -569,70 +1647,290 @@ func (c *CoreAPI) scan(documentPrimary, documentSecondary, biometricPhoto, biome
 		ContractGenerate:      c.config.contractGenerate,
 		ContractFormat:        c.config.contractFormat,
 		ContractPrefillData:   c.config.contractPrefillData,
-		Client:                c.config.client,
+		Client:                c.client(),
 	}
 
+	if c.config.testMode {
+		payload.VaultSave = false
+		payload.VaultSaveUnrecognized = false
+	}
+
+	return payload
+}
+
+// An unlocked copy of c with opts applied, or a snapshot of c when there are none
+// Every scan takes this once up front and passes it down, so the whole scan sees a single configuration
+func (c *CoreAPI) withOverrides(opts []ScanOption) (*CoreAPI, error) {
+	if len(opts) == 0 {
+		return c.snapshot(), nil
+	}
+
+	scoped := c.Clone()
+	scoped.mutex = nil
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt(scoped); err != nil {
+			return nil, err
+		}
+	}
+
+	return scoped, nil
+}
+
+// Take the configuration write lock when built WithThreadSafe, returning the matching unlock
+func (c *CoreAPI) lock() func() {
+	if c.mutex == nil {
+		return func() {}
+	}
+	c.mutex.Lock()
+
+	return c.mutex.Unlock
+}
+
+// A copy of c to read the configuration from without holding the lock, when built WithThreadSafe
+func (c *CoreAPI) snapshot() *CoreAPI {
+	if c.mutex == nil {
+		return c
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	snapshot := *c
+	snapshot.mutex = nil
+
+	return &snapshot
+}
+
+// An unlocked copy of c to apply several setters to before writing its configuration back, all while holding c's write lock
+// so no other setter can run in between and be overwritten
+func (c *CoreAPI) staged() CoreAPI {
+	staged := *c
+	staged.mutex = nil
+
+	return staged
+}
+
+// Send a scan request using the configured upload mode
+func (c *CoreAPI) postScan(ctx context.Context, payload coreRequest, result interface{}) ([]byte, error) {
+	files := map[string]string{
+		"file":      payload.FileBase64,
+		"file_back": payload.FileBackBase64,
+		"face":      payload.FaceBase64,
+		"video":     payload.VideoBase64,
+	}
+	documentType := imageFormatTypes[c.imageFormat]
+	if c.uploadMode != UploadMultipart || payload.FileBase64 == "" && payload.FileBackBase64 == "" && payload.FaceBase64 == "" && payload.VideoBase64 == "" {
+		if documentType != "" {
+			for _, content := range []*string{&payload.FileBase64, &payload.FileBackBase64} {
+				if *content != "" {
+					*content = "data:" + documentType + ";base64," + *content
+				}
+			}
+		}
+
+		return c.doJSON(ctx, c.apiEndpoint, payload, result)
+	}
+
+	payload.FileBase64, payload.FileBackBase64, payload.FaceBase64, payload.VideoBase64 = "", "", "", ""
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	fields := map[string]interface{}{}
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		writer.CloseWithError(writeScanForm(form, fields, files, documentType))
+	}()
+	defer body.Close()
+
+	response, err := c.doRequest(ctx, http.MethodPost, c.apiEndpoint, form.FormDataContentType(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to API server: %w", err)
+	}
+	defer response.Body.Close()
+
+	raw, err := readResponse(response)
+	if err != nil {
+		return nil, err
+	}
+	setRequestID(result, response.Header)
+
+	if err := parseResponse(raw, result); err != nil {
+		return raw, err
+	}
+	c.checkUnknownFields(c.apiEndpoint, raw, result)
+
+	return raw, nil
+}
+
+// Write the request fields as form values, and the base64 inputs decoded back to binary file parts
+// Booleans are sent as 1 or 0, and objects and arrays as JSON text; document parts use documentType when it is set
+func writeScanForm(form *multipart.Writer, fields map[string]interface{}, files map[string]string, documentType string) error {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var value string
+		switch field := fields[name].(type) {
+		case nil:
+			continue
+		case string:
+			if field == "" && strings.HasSuffix(name, "_base64") {
+				continue
+			}
+			value = field
+		case bool:
+			value = "0"
+			if field {
+				value = "1"
+			}
+		case json.Number:
+			value = field.String()
+		default:
+			encoded, err := json.Marshal(field)
+			if err != nil {
+				return err
+			}
+			value = string(encoded)
+		}
+
+		if err := form.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range []string{"file", "file_back", "face", "video"} {
+		if files[name] == "" {
+			continue
+		}
+
+		var part io.Writer
+		var err error
+		if documentType != "" && (name == "file" || name == "file_back") {
+			header := textproto.MIMEHeader{}
+			header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, name, name))
+			header.Set("Content-Type", documentType)
+			part, err = form.CreatePart(header)
+		} else {
+			part, err = form.CreateFormFile(name, name)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, base64.NewDecoder(base64.StdEncoding, strings.NewReader(files[name]))); err != nil {
+			return err
+		}
+	}
+
+	return form.Close()
+}
+
+// Work out what kind of input each image string is, as DetectImageInput does; empty strings give nil inputs
+func (c *CoreAPI) detectInputs(documentPrimary, documentSecondary, biometricPhoto, biometricVideo string) (primary, secondary, photo, video ImageInput, err error) {
+	var ok bool
+
 	if documentPrimary == "" {
-		return &http.Response{}, errors.New("primary document image required")
+		return nil, nil, nil, nil, errors.New("primary document image required")
 	}
 
-	if _, err := url.ParseRequestURI(documentPrimary); err == nil {
-		payload.Url = documentPrimary
-	} else if fileExists(documentPrimary) {
-		payload.FileBase64 = base64File(documentPrimary)
-	} else if len(documentPrimary) > 100 {
-		payload.FileBase64 = documentPrimary
-	} else {
-		return &http.Response{}, errors.New("invalid primary document image, file not found or malformed URL")
+	if c.config.strictInput {
+		for _, image := range []string{documentPrimary, documentSecondary, biometricPhoto, biometricVideo} {
+			if err := checkAmbiguousImage(image); err != nil {
+				return nil, nil, nil, nil, err
+			}
+		}
+	}
+
+	if primary, ok = DetectImageInput(documentPrimary); !ok {
+		return nil, nil, nil, nil, errors.New("invalid primary document image, file not found or malformed URL")
 	}
 
 	if documentSecondary != "" {
-		if _, err := url.ParseRequestURI(documentSecondary); err == nil {
-			payload.UrlBack = documentSecondary
-		} else if fileExists(documentSecondary) {
-			payload.FileBackBase64 = base64File(documentSecondary)
-		} else if len(documentSecondary) > 100 {
-			payload.FileBackBase64 = documentSecondary
-		} else {
-			return &http.Response{}, errors.New("invalid secondary document image, file not found or malformed URL")
+		if secondary, ok = DetectImageInput(documentSecondary); !ok {
+			return nil, nil, nil, nil, errors.New("invalid secondary document image, file not found or malformed URL")
 		}
 	}
 
 	if biometricPhoto != "" {
-		if _, err := url.ParseRequestURI(biometricPhoto); err == nil {
-			payload.FaceUrl = biometricPhoto
-		} else if fileExists(biometricPhoto) {
-			payload.FaceBase64 = base64File(biometricPhoto)
-		} else if len(biometricPhoto) > 100 {
-			payload.FaceBase64 = biometricPhoto
-		} else {
-			return &http.Response{}, errors.New("invalid face image, file not found or malformed URL")
+		if photo, ok = DetectImageInput(biometricPhoto); !ok {
+			return nil, nil, nil, nil, errors.New("invalid face image, file not found or malformed URL")
 		}
 	}
 
 	if biometricVideo != "" {
-		if _, err := url.ParseRequestURI(biometricVideo); err == nil {
-			payload.VideoUrl = biometricVideo
-		} else if fileExists(biometricVideo) {
-			payload.VideoBase64 = base64File(biometricVideo)
-		} else if len(biometricVideo) > 100 {
-			payload.VideoBase64 = biometricVideo
-		} else {
-			return &http.Response{}, errors.New("invalid face video, file not found or malformed URL")
+		if video, ok = DetectImageInput(biometricVideo); !ok {
+			return nil, nil, nil, nil, errors.New("invalid face video, file not found or malformed URL")
 		}
+	}
 
-		if matched, _ := regexp.MatchString(`^[0-9]{4}`, biometricVideoPasscode); !matched {
-			return &http.Response{}, errors.New("please provide a 4 digit passcode for video biometric verification")
-		} else {
-			payload.Passcode = biometricVideoPasscode
+	return primary, secondary, photo, video, nil
+}
+
+func (c *CoreAPI) buildRequestInput(documentPrimary, documentSecondary, biometricPhoto, biometricVideo ImageInput, biometricVideoPasscode string) (coreRequest, error) {
+	var err error
+	payload := c.requestFromConfig()
+
+	if documentPrimary == nil {
+		return coreRequest{}, errors.New("primary document image required")
+	}
+
+	if payload.Url, payload.FileBase64, err = documentPrimary.resolve(c.maxUploadSize); err != nil {
+		return coreRequest{}, fmt.Errorf("invalid primary document image: %s", err.Error())
+	}
+
+	if documentSecondary != nil {
+		if payload.UrlBack, payload.FileBackBase64, err = documentSecondary.resolve(c.maxUploadSize); err != nil {
+			return coreRequest{}, fmt.Errorf("invalid secondary document image: %s", err.Error())
 		}
 	}
 
-	body, _ := json.Marshal(payload)
+	if biometricPhoto != nil {
+		if payload.FaceUrl, payload.FaceBase64, err = biometricPhoto.resolve(c.maxUploadSize); err != nil {
+			return coreRequest{}, fmt.Errorf("invalid face image: %s", err.Error())
+		}
+	}
 
-	if response, err := http.Post(c.apiEndpoint, "application/json", bytes.NewBuffer(body)); err != nil {
-		return &http.Response{}, fmt.Errorf("failed to connect to API server: %s", err.Error())
-	} else {
-		return response, nil
+	if biometricVideo != nil {
+		if payload.VideoUrl, payload.VideoBase64, err = biometricVideo.resolve(c.maxUploadSize); err != nil {
+			return coreRequest{}, fmt.Errorf("invalid face video: %s", err.Error())
+		}
+
+		if biometricVideoPasscode == "" {
+			biometricVideoPasscode = DefaultVideoPasscode
+		}
+		if matched, _ := regexp.MatchString(`^[0-9]{4}$`, biometricVideoPasscode); !matched {
+			return coreRequest{}, errors.New("please provide a 4 digit passcode for video biometric verification")
+		}
+		payload.Passcode = biometricVideoPasscode
 	}
+
+	return payload, nil
+}
+
+func fsInput(fsys fs.FS, name string) ImageInput {
+	if name == "" {
+		return nil
+	}
+
+	return FSInput{FS: fsys, Name: name}
+}
+
+func readerInput(reader io.Reader) ImageInput {
+	if reader == nil {
+		return nil
+	}
+
+	return ReaderInput{Reader: reader}
 }
@@ -0,0 +1,599 @@
+package idanalyzer_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/danhunsaker/idanalyzer-go-sdk"
+	"github.com/danhunsaker/idanalyzer-go-sdk/idanalyzertest"
+)
+
+const testDocumentURL = "https://example.com/id.jpg"
+
+func newTestCore(t testing.TB, handler http.Handler, opts ...idanalyzer.CoreOption) idanalyzer.CoreAPI {
+	t.Helper()
+
+	server := idanalyzertest.NewServer(map[string]http.Handler{idanalyzertest.PathCore: handler})
+	t.Cleanup(server.Close)
+
+	core, err := idanalyzer.NewCoreAPI("key", "", append([]idanalyzer.CoreOption{server.Option()}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return core
+}
+
+func rawJSON(body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	})
+}
+
+// Answer with response, keeping the decoded request body in payload
+func capturePayload(payload *map[string]interface{}, response interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*payload = nil
+		json.NewDecoder(r.Body).Decode(payload)
+		idanalyzertest.JSON(response).ServeHTTP(w, r)
+	})
+}
+
+func TestCheckDigitPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{"failed", `{"result":{},"verification":{"passed":false,"result":{"checkdigit":false}}}`, true},
+		{"passed", `{"result":{},"verification":{"passed":true,"result":{"checkdigit":true}}}`, false},
+		{"no MRZ", `{"result":{},"verification":{"passed":true,"result":{"notexpired":true}}}`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			core := newTestCore(t, rawJSON(test.body))
+			if err := core.SetCheckDigitPolicy(idanalyzer.PolicyReject); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := core.ScanFront(testDocumentURL)
+			var checkDigitError *idanalyzer.CheckDigitError
+			if got := errors.As(err, &checkDigitError); got != test.want {
+				t.Errorf("expected check digit error %v, got %v", test.want, err)
+			}
+		})
+	}
+}
+
+func TestThreadSafeSettersAreNotReverted(t *testing.T) {
+	core := newTestCore(t, rawJSON(`{}`), idanalyzer.WithThreadSafe())
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := core.SetVerifications(map[string]string{"name": "JANE SAMPLE", "dob": "1990-01-02"}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	defer wg.Wait()
+	defer close(done)
+
+	for i := 0; i < 50; i++ {
+		country := fmt.Sprintf("C%d", i)
+		core.RestrictCountry(country)
+		// let a SetVerifications that started before RestrictCountry finish, so a stale write-back would show below
+		runtime.Gosched()
+
+		data, err := core.ConfigJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var config struct {
+			Country string `json:"country"`
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			t.Fatal(err)
+		}
+		if config.Country != country {
+			t.Fatalf("RestrictCountry(%q) was reverted to %q by a concurrent SetVerifications", country, config.Country)
+		}
+	}
+}
+
+// Run with -race too: each scan must build and send its request from one configuration snapshot, even while setters run
+func TestThreadSafeScansSeeOneConfiguration(t *testing.T) {
+	core := newTestCore(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Accuracy     uint   `json:"accuracy"`
+			Authenticate bool   `json:"authenticate"`
+			VerifyName   string `json:"verify_name"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		// the type accuracy detection scan has authentication off; the scan itself must use the accuracy set with its name
+		if step, err := strconv.Atoi(payload.VerifyName); err == nil && payload.Authenticate {
+			if payload.Accuracy != uint(step%3) && payload.Accuracy != uint((step+1)%3) {
+				t.Errorf("scan mixed configurations: name from step %d with accuracy %d", step, payload.Accuracy)
+			}
+		}
+		idanalyzertest.JSON(idanalyzertest.CoreSuccess()).ServeHTTP(w, r)
+	}), idanalyzer.WithThreadSafe())
+	if err := core.EnableAuthentication(true, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.SetAccuracyForType("D", 0); err != nil {
+		t.Fatal(err)
+	}
+	core.VerifyName("0")
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for step := 1; ; step++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			// accuracy first, so a snapshot holding step's name always holds step's accuracy or the next one
+			if err := core.SetAccuracyForType("D", uint(step%3)); err != nil {
+				t.Error(err)
+				return
+			}
+			core.VerifyName(strconv.Itoa(step))
+		}
+	}()
+	defer wg.Wait()
+	defer close(done)
+
+	var scans sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		scans.Add(1)
+		go func() {
+			defer scans.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := core.ScanFront(testDocumentURL); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	scans.Wait()
+}
+
+func TestScanVariantsApplyOptionsAndContext(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n")
+	var countries []string
+	var mutex sync.Mutex
+	core := newTestCore(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Country string `json:"country"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		mutex.Lock()
+		countries = append(countries, payload.Country)
+		mutex.Unlock()
+		idanalyzertest.JSON(idanalyzertest.CoreSuccess()).ServeHTTP(w, r)
+	}))
+	fsys := fstest.MapFS{"front.png": &fstest.MapFile{Data: png}}
+	override := idanalyzer.WithCountryOverride("US")
+
+	scans := map[string]func(ctx context.Context) error{
+		"FS": func(ctx context.Context) error {
+			_, err := core.ScanFrontFSContext(ctx, fsys, "front.png", override)
+			return err
+		},
+		"Reader": func(ctx context.Context) error {
+			_, err := core.ScanFrontReaderContext(ctx, bytes.NewReader(png), override)
+			return err
+		},
+		"Bytes": func(ctx context.Context) error {
+			_, err := core.ScanBothBytesContext(ctx, png, png, override)
+			return err
+		},
+		"Batch": func(ctx context.Context) error {
+			_, err := core.ScanBatch(ctx, []string{testDocumentURL}, 1, override)
+			var batchError *idanalyzer.BatchError
+			if errors.As(err, &batchError) {
+				return batchError.Errors[0]
+			}
+			return err
+		},
+	}
+
+	for name, scan := range scans {
+		t.Run(name, func(t *testing.T) {
+			countries = nil
+			if err := scan(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if len(countries) != 1 || countries[0] != "US" {
+				t.Errorf("expected the country override to be sent, got %q", countries)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			if err := scan(ctx); !errors.Is(err, context.Canceled) {
+				t.Errorf("expected context.Canceled, got %v", err)
+			}
+		})
+	}
+}
+
+func TestTypeAccuracyDetectionError(t *testing.T) {
+	var scans int
+	core := newTestCore(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scans++
+		idanalyzertest.Error(idanalyzertest.ErrCountryRestricted()).ServeHTTP(w, r)
+	}))
+	if err := core.SetAccuracyForType("P", idanalyzer.AccuracyAccurate); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := core.ScanFront(testDocumentURL)
+	var apiError *idanalyzer.APIError
+	if !errors.As(err, &apiError) || apiError.Code != idanalyzertest.ErrCountryRestricted().Code {
+		t.Errorf("expected the detection scan's API error, got %v", err)
+	}
+	if scans != 1 {
+		t.Errorf("expected the scan to stop after detection, got %d requests", scans)
+	}
+}
+
+func TestScanAutoSwapsSidesOnlyWhenAsked(t *testing.T) {
+	var fronts []string
+	core := newTestCore(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			URL string `json:"url"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		fronts = append(fronts, payload.URL)
+
+		side := "FRONT"
+		if payload.URL == "https://example.com/back.jpg" {
+			side = "BACK"
+		}
+		rawJSON(fmt.Sprintf(`{"result":{"documentSide":%q}}`, side)).ServeHTTP(w, r)
+	}))
+	images := []string{"https://example.com/back.jpg", "https://example.com/front.jpg"}
+
+	result, err := core.ScanAutoContext(context.Background(), images)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fronts) != 1 || result.BothSides.Result.DocumentSide != "BACK" {
+		t.Errorf("expected one scan reporting the back side, got %d scans and side %q", len(fronts), result.BothSides.Result.DocumentSide)
+	}
+
+	fronts = nil
+	result, err = core.ScanAuto(images, idanalyzer.WithSideSwap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fronts) != 2 || fronts[1] != images[1] || result.BothSides.Result.DocumentSide != "FRONT" {
+		t.Errorf("expected a second scan with the images swapped, got scans of %q", fronts)
+	}
+}
+
+func TestInvalidBase64IsRefusedLocally(t *testing.T) {
+	var requests int
+	core := newTestCore(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		idanalyzertest.JSON(idanalyzertest.CoreSuccess()).ServeHTTP(w, r)
+	}))
+
+	if _, err := core.ScanFront("data:image/jpeg;base64," + strings.Repeat("!", 200)); err == nil {
+		t.Error("expected invalid base64 to be refused")
+	}
+	if requests != 0 {
+		t.Errorf("expected no request to be sent, got %d", requests)
+	}
+}
+
+func TestDisablingAuthenticationSkipsModuleValidation(t *testing.T) {
+	core, err := idanalyzer.NewCoreAPI("key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	docuPass, err := idanalyzer.NewDocuPassAPI("key", "Company", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, module := range []string{"", "1", "quick", "bogus"} {
+		if err := core.EnableAuthentication(false, module); err != nil {
+			t.Errorf("Core module %q: expected no error when disabling, got %v", module, err)
+		}
+		if err := docuPass.EnableAuthentication(false, module, 0.5); err != nil {
+			t.Errorf("DocuPass module %q: expected no error when disabling, got %v", module, err)
+		}
+	}
+
+	if err := core.EnableAuthentication(true, "bogus"); err == nil {
+		t.Error("expected an invalid module to be refused when enabling")
+	}
+}
+
+func TestSetCropDocument(t *testing.T) {
+	var payload map[string]interface{}
+	core := newTestCore(t, capturePayload(&payload, idanalyzertest.CoreSuccess()))
+
+	server := idanalyzertest.NewServer(map[string]http.Handler{
+		idanalyzertest.PathDocuPassCreate: capturePayload(&payload, idanalyzertest.DocuPassIdentitySuccess()),
+	})
+	t.Cleanup(server.Close)
+	docuPass, err := idanalyzer.NewDocuPassAPI("key", "Company", "", server.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, enabled := range []bool{true, false} {
+		core.SetCropDocument(enabled)
+		if _, err := core.ScanFront(testDocumentURL); err != nil {
+			t.Fatal(err)
+		}
+		if payload["outputimage"] != enabled {
+			t.Errorf("Core: expected outputimage %v, got %v", enabled, payload["outputimage"])
+		}
+
+		docuPass.SetCropDocument(enabled)
+		if _, err := docuPass.CreateIFrame(); err != nil {
+			t.Fatal(err)
+		}
+		if payload["crop_document"] != enabled {
+			t.Errorf("DocuPass: expected crop_document %v, got %v", enabled, payload["crop_document"])
+		}
+	}
+}
+
+func TestScanFrontVideoUsesDefaultPasscode(t *testing.T) {
+	var payload map[string]interface{}
+	core := newTestCore(t, capturePayload(&payload, idanalyzertest.CoreSuccess()))
+
+	if _, err := core.ScanFrontVideo(testDocumentURL, "https://example.com/selfie.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if payload["passcode"] != idanalyzer.DefaultVideoPasscode {
+		t.Errorf("expected passcode %q, got %v", idanalyzer.DefaultVideoPasscode, payload["passcode"])
+	}
+}
+
+// Compare the bytes sent for a 1MB document in each upload mode, reported as wire-B/op
+func BenchmarkUploadMode(b *testing.B) {
+	document := append([]byte("\xff\xd8\xff\xe0"), bytes.Repeat([]byte{0x42}, 1<<20)...)
+
+	for _, mode := range []struct {
+		name string
+		mode idanalyzer.UploadMode
+	}{{"Base64", idanalyzer.UploadBase64}, {"Multipart", idanalyzer.UploadMultipart}} {
+		b.Run(mode.name, func(b *testing.B) {
+			var sent int64
+			core := newTestCore(b, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n, _ := io.Copy(io.Discard, r.Body)
+				sent += n
+				idanalyzertest.JSON(idanalyzertest.CoreSuccess()).ServeHTTP(w, r)
+			}), idanalyzer.WithUploadMode(mode.mode))
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := core.ScanFrontBytes(document); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(sent)/float64(b.N), "wire-B/op")
+		})
+	}
+}
+
+func TestSetOCRImageResizeBounds(t *testing.T) {
+	var payload map[string]interface{}
+	core := newTestCore(t, capturePayload(&payload, idanalyzertest.CoreSuccess()))
+
+	for scale, valid := range map[uint]bool{idanalyzer.OCRResizeDisabled: true, 499: false, 500: true, 4000: true, 4001: false} {
+		err := core.SetOCRImageResize(scale)
+		if (err == nil) != valid {
+			t.Errorf("scale %d: expected valid %v, got %v", scale, valid, err)
+			continue
+		}
+		if !valid {
+			continue
+		}
+
+		if _, err := core.ScanFront(testDocumentURL); err != nil {
+			t.Fatal(err)
+		}
+		if payload["ocr_scaledown"] != float64(scale) {
+			t.Errorf("scale %d: expected ocr_scaledown to be sent, got %v", scale, payload["ocr_scaledown"])
+		}
+	}
+}
+
+// Run with go test -race to check clones share no mutable configuration with their base
+func TestCloneIsIndependent(t *testing.T) {
+	core := newTestCore(t, idanalyzertest.JSON(idanalyzertest.CoreSuccess()))
+	core.RestrictCountry("US")
+	core.SetAMLDatabase("us_ofac")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			clone := core.Clone()
+			clone.RestrictCountry(fmt.Sprintf("C%d", i))
+			clone.SetAMLDatabase("un_sc")
+			if err := clone.SetVerifications(map[string]string{"name": "JANE SAMPLE"}); err != nil {
+				t.Error(err)
+			}
+			if _, err := clone.ScanFront(testDocumentURL); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	config, err := core.ConfigJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload map[string]interface{}
+	json.Unmarshal(config, &payload)
+	if payload["country"] != "US" || payload["aml_database"] != "us_ofac" || payload["verify_name"] != "" {
+		t.Errorf("expected the base configuration to be untouched by clones, got %v", payload)
+	}
+}
+
+func TestWithTimeoutStopsSlowRequests(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	core := newTestCore(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}), idanalyzer.WithTimeout(50*time.Millisecond))
+
+	started := time.Now()
+	_, err := core.ScanFront(testDocumentURL)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("expected the request to time out quickly, took %s", elapsed)
+	}
+}
+
+func TestEnableBlocklistCheck(t *testing.T) {
+	var payload map[string]interface{}
+	core := newTestCore(t, capturePayload(&payload, idanalyzertest.CoreSuccess()))
+
+	for _, enabled := range []bool{true, false} {
+		core.EnableBlocklistCheck(enabled)
+		if _, err := core.ScanFront(testDocumentURL); err != nil {
+			t.Fatal(err)
+		}
+		if payload["checkblocklist"] != enabled {
+			t.Errorf("expected checkblocklist %v, got %v", enabled, payload["checkblocklist"])
+		}
+	}
+}
+
+func TestLoadConfigRoundTrip(t *testing.T) {
+	core := newTestCore(t, rawJSON(`{}`))
+	if err := core.SetAccuracy(idanalyzer.AccuracyBalanced); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.EnableAuthentication(true, "quick"); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.SetOCRImageResize(1600); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.EnableImageOutput(true, true, "base64"); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.SetVerifications(map[string]string{"name": "JANE SAMPLE", "dob": "1990-01-02", "age": "18-65"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.SetBiometricThreshold(0.6); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.GenerateContract("template", "PDF", map[string]interface{}{"plan": "gold"}); err != nil {
+		t.Fatal(err)
+	}
+	core.EnableDualSideCheck(true)
+	core.RestrictCountry("US,CA")
+	core.EnableVault(true, false, true, false)
+	core.SetVaultData("one", "", "", "", "five")
+	core.SetAMLDatabase("us_ofac")
+
+	want, err := core.ConfigJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newTestCore(t, rawJSON(`{}`))
+	if err := loaded.LoadConfig(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loaded.ConfigJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("expected the loaded configuration to match\nwant %s\n got %s", want, got)
+	}
+}
+
+func TestLoadConfigRejectsBadInput(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":    `{"accuracy":2,"surprise":true}`,
+		"invalid accuracy": `{"accuracy":7}`,
+		"invalid dob":      `{"verify_dob":"yesterday"}`,
+		"invalid age":      `{"verify_age":"old"}`,
+		"API key":          `{"apikey":"secret"}`,
+		"image":            `{"url":"https://example.com/id.jpg"}`,
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			core := newTestCore(t, rawJSON(`{}`))
+			core.RestrictCountry("US")
+			before, _ := core.ConfigJSON()
+
+			if err := core.LoadConfig([]byte(data)); err == nil {
+				t.Errorf("expected %s to be rejected", data)
+			}
+			if after, _ := core.ConfigJSON(); !bytes.Equal(after, before) {
+				t.Errorf("expected a rejected config to change nothing, got %s", after)
+			}
+		})
+	}
+}
+
+func TestScanFrontFaceImageSizeLimit(t *testing.T) {
+	var payload map[string]interface{}
+	core := newTestCore(t, capturePayload(&payload, idanalyzertest.CoreSuccess()))
+
+	if _, err := core.ScanFrontFaceImage(testDocumentURL, image.NewUniform(color.White)); err == nil || payload != nil {
+		t.Errorf("expected an unbounded image to be refused before any request, got %v", err)
+	}
+
+	face := image.NewGray(image.Rect(0, 0, 64, 64))
+	if _, err := core.ScanFrontFaceImage(testDocumentURL, face); err != nil {
+		t.Fatal(err)
+	}
+	if encoded, _ := payload["face_base64"].(string); encoded == "" {
+		t.Errorf("expected the face to be sent as base64, got %v", payload)
+	}
+}
@@ -2,50 +2,147 @@ package idanalyzer
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
+	"html/template"
+	"image/color"
 	"io"
-	"net"
+	"mime"
 	"net/http"
 	"net/url"
+	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type DocuPassAPI struct {
-	apiKey      string
-	apiEndpoint string
-	companyName string
-	config      docuPassConfig
+	apiClient
+	companyName     string
+	config          docuPassConfig
+	callbackMaxSize int64
 }
 
+// Returned (wrapped) by ParseIdentityCallback and ParseSignatureCallback when the request body exceeds the SetCallbackMaxSize limit
+var ErrCallbackTooLarge = errors.New("callback body too large")
+
+// Returned (wrapped) by ParseIdentityCallback and ParseSignatureCallback when the request isn't a JSON POST
+var ErrCallbackContentType = errors.New("callback must be POSTed as application/json")
+
+// Returned (wrapped) by ParseIdentityCallback and ParseSignatureCallback, alongside the verified callback, when re-posting
+// it to a URL added with AddCallbackForward fails
+var ErrCallbackForward = errors.New("failed to forward callback")
+
 type DocuPassIdentityResponse struct {
-	Error     *APIError `json:"error,omitempty"`
-	Reference string    `json:"reference"`
-	Type      uint      `json:"type"`
-	CustomID  string    `json:"customid"`
-	URL       string    `json:"url"`
-	QRCode    string    `json:"qrcode"`
-	BaseURL   string    `json:"base_url"`
-	HTML      string    `json:"html"`
-	SMSSent   string    `json:"smssent"`
-	Expiry    string    `json:"expiry"`
+	Error       *APIError `json:"error,omitempty"`
+	Reference   string    `json:"reference"`
+	Type        uint      `json:"type"` // See SessionType for the typed value
+	CustomID    string    `json:"customid"`
+	URL         string    `json:"url"`
+	QRCode      string    `json:"qrcode"`
+	BaseURL     string    `json:"base_url"`
+	HTML        string    `json:"html"`
+	SMSSent     string    `json:"smssent"`
+	Expiry      string    `json:"expiry"`
+	RawResponse []byte    `json:"-"` // Copy of the exact JSON returned by the API
+	RequestID   string    `json:"-"` // Request ID from the API server's response headers, for support tickets; empty if the server sent none
 }
 
 type DocuPassSignatureResponse struct {
-	Error      *APIError `json:"error,omitempty"`
-	Reference  string    `json:"reference"`
-	CustomID   string    `json:"customid"`
-	URL        string    `json:"url"`
-	QRCode     string    `json:"qrcode"`
-	BaseURL    string    `json:"base_url"`
-	HTMLQRCode string    `json:"html_qrcode"`
-	HTMLIFrame string    `json:"html_iframe"`
-	SMSSent    string    `json:"smssent"`
-	Expiry     string    `json:"expiry"`
+	Error       *APIError `json:"error,omitempty"`
+	Reference   string    `json:"reference"`
+	CustomID    string    `json:"customid"`
+	URL         string    `json:"url"`
+	QRCode      string    `json:"qrcode"`
+	BaseURL     string    `json:"base_url"`
+	HTMLQRCode  string    `json:"html_qrcode"`
+	HTMLIFrame  string    `json:"html_iframe"`
+	SMSSent     string    `json:"smssent"`
+	Expiry      string    `json:"expiry"`
+	RawResponse []byte    `json:"-"` // Copy of the exact JSON returned by the API
+	RequestID   string    `json:"-"` // Request ID from the API server's response headers, for support tickets; empty if the server sent none
+}
+
+// Kind of DocuPass identity verification session, as passed to Create and returned by DocuPassIdentityResponse.SessionType
+type DocuPassType uint
+
+const (
+	DocuPassTypeIFrame      DocuPassType = 0 // for embedding in web page as iframe
+	DocuPassTypeMobile      DocuPassType = 1 // for users to open on mobile phone, or embedding in mobile app
+	DocuPassTypeRedirection DocuPassType = 2 // for users to open in any browser
+	DocuPassTypeLiveMobile  DocuPassType = 3 // DocuPass Live Mobile, for users to open on mobile phone
+)
+
+var docuPassTypeNames = map[DocuPassType]string{
+	DocuPassTypeIFrame:      "iframe",
+	DocuPassTypeMobile:      "mobile",
+	DocuPassTypeRedirection: "redirection",
+	DocuPassTypeLiveMobile:  "live mobile",
+}
+
+// The session type as a DocuPassType, for comparing against the DocuPassType constants
+func (r DocuPassIdentityResponse) SessionType() DocuPassType {
+	return DocuPassType(r.Type)
+}
+
+// Name of the session type, e.g. "iframe" or "live mobile"; unknown types are named by number
+func (r DocuPassIdentityResponse) TypeName() string {
+	if name, ok := docuPassTypeNames[r.SessionType()]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("unknown (%d)", r.Type)
+}
+
+// When the session link stops working, parsed from Expiry
+func (r DocuPassIdentityResponse) ExpiryTime() (time.Time, error) {
+	return parseDocuPassExpiry(r.Expiry)
+}
+
+// Whether DocuPass sent the session link by SMS, as reported in SMSSent
+func (r DocuPassIdentityResponse) SMSWasSent() bool {
+	return docuPassSMSSent(r.SMSSent)
+}
+
+// When the session link stops working, parsed from Expiry
+func (r DocuPassSignatureResponse) ExpiryTime() (time.Time, error) {
+	return parseDocuPassExpiry(r.Expiry)
+}
+
+// Whether DocuPass sent the session link by SMS, as reported in SMSSent
+func (r DocuPassSignatureResponse) SMSWasSent() bool {
+	return docuPassSMSSent(r.SMSSent)
+}
+
+// Build an iframe tag for the session URL, instead of embedding the HTML returned by the server
+// attrs may set width, height, sandbox, allow, title, loading, referrerpolicy, class, id and name; values are escaped
+func (r DocuPassIdentityResponse) IFrameTag(attrs map[string]string) (template.HTML, error) {
+	return docuPassIFrame(r.URL, attrs)
+}
+
+// Build an iframe tag for the session URL, instead of embedding the HTML returned by the server
+// attrs may set width, height, sandbox, allow, title, loading, referrerpolicy, class, id and name; values are escaped
+func (r DocuPassSignatureResponse) IFrameTag(attrs map[string]string) (template.HTML, error) {
+	return docuPassIFrame(r.URL, attrs)
+}
+
+// The session QR code as PNG bytes, decoded from a base64 data URI or downloaded from a hosted URL, whichever QRCode holds
+// client may be nil to use http.DefaultClient; downloads are bounded by ctx and limited to 1MB
+func (r DocuPassIdentityResponse) QRCodePNG(ctx context.Context, client *http.Client) ([]byte, error) {
+	return docuPassQRCode(ctx, client, r.QRCode)
+}
+
+// The session QR code as PNG bytes, decoded from a base64 data URI or downloaded from a hosted URL, whichever QRCode holds
+// client may be nil to use http.DefaultClient; downloads are bounded by ctx and limited to 1MB
+func (r DocuPassSignatureResponse) QRCodePNG(ctx context.Context, client *http.Client) ([]byte, error) {
+	return docuPassQRCode(ctx, client, r.QRCode)
 }
 
 type DocuPassIdentityCallback struct {
@@ -65,6 +162,39 @@ type DocuPassIdentityCallback struct {
 	DocumentImage  []DocuPassCallbackImageData `json:"documentimage,omitempty"`
 	FaceImage      []DocuPassCallbackImageData `json:"faceimage,omitempty"`
 	VaultID        string                      `json:"vaultid,omitempty"`
+	RawBody        []byte                      `json:"-"` // Copy of the exact JSON body DocuPass posted, when read by ParseIdentityCallback
+}
+
+// Descriptions of DocuPass callback FailCode values, as used by FailedVerifications
+// The API documentation doesn't list the codes, so none are built in; add the ones your integration sees, and any code
+// missing from the map is described by the callback's own FailReason
+var DocuPassFailCodes = map[string]string{}
+
+// Human-readable reasons the session failed, for triage by support staff; empty when the session succeeded
+// FailCode is described using DocuPassFailCodes, falling back to FailReason, followed by each verification check that
+// did not pass; only checks present in RawBody are listed, so a callback built by hand (without RawBody) lists every
+// check that is false, including ones never requested
+func (c DocuPassIdentityCallback) FailedVerifications() []string {
+	failed := []string{}
+	if !c.Success {
+		if description, ok := DocuPassFailCodes[c.FailCode]; ok {
+			failed = append(failed, description)
+		} else if c.FailReason != "" {
+			failed = append(failed, c.FailReason)
+		}
+	}
+
+	if c.Verification != nil && !c.Verification.Passed {
+		for _, check := range failedVerificationChecks(c.RawBody, c.Verification) {
+			description, ok := docuPassCheckDescriptions[check]
+			if !ok {
+				description = check + " check did not pass"
+			}
+			failed = append(failed, description)
+		}
+	}
+
+	return failed
 }
 
 type DocuPassSignatureCallback struct {
@@ -75,6 +205,7 @@ type DocuPassSignatureCallback struct {
 	FailReason string           `json:"failreason,omitempty"`
 	FailCode   string           `json:"failcode,omitempty"`
 	Contract   *APIContractData `json:"contract,omitempty"`
+	RawBody    []byte           `json:"-"` // Copy of the exact JSON body DocuPass posted, when read by ParseSignatureCallback
 }
 
 type DocuPassCallbackPhone struct {
@@ -88,13 +219,95 @@ type DocuPassCallbackImageData struct {
 	Content string `json:"content"`
 }
 
+// Progress of a DocuPass session, as reported by GetSessionStatus
+type DocuPassSessionStatus struct {
+	Reference  string
+	State      string     // DocuPassSessionPending, DocuPassSessionSucceeded or DocuPassSessionFailed
+	FailReason string     // Why the session failed, when State is DocuPassSessionFailed
+	Entry      *VaultData // Vault entry saved when the session finished, nil while pending
+}
+
+// DocuPassSessionStatus states
+const (
+	DocuPassSessionPending   = "pending"
+	DocuPassSessionSucceeded = "succeeded"
+	DocuPassSessionFailed    = "failed"
+)
+
+// Tracks the users completing one reusable DocuPass link (see SetReusable), each of whom gets their own reference code
+// Safe for concurrent use, so callback handlers can Register while other goroutines Lookup
+type ReusableSession struct {
+	Reference string // Reference code of the reusable link itself
+	URL       string
+	CustomID  string // Custom ID set when the link was created, which DocuPass repeats in every callback
+
+	mu        sync.RWMutex
+	callbacks map[string]DocuPassIdentityCallback
+	order     []string
+}
+
+// Start tracking a reusable link, as returned by one of the Create methods
+func NewReusableSession(created DocuPassIdentityResponse) *ReusableSession {
+	return &ReusableSession{
+		Reference: created.Reference,
+		URL:       created.URL,
+		CustomID:  created.CustomID,
+		callbacks: map[string]DocuPassIdentityCallback{},
+	}
+}
+
+// Record a verified callback under its reference code; a repeated callback for the same reference replaces the earlier one
+// Callbacks carrying a different custom ID than the link were not issued for this link, and are rejected
+func (s *ReusableSession) Register(callback DocuPassIdentityCallback) error {
+	if callback.Reference == "" {
+		return errors.New("callback has no reference")
+	}
+	if s.CustomID != "" && callback.CustomID != s.CustomID {
+		return fmt.Errorf("callback custom ID %q does not match reusable link custom ID %q", callback.CustomID, s.CustomID)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.callbacks[callback.Reference]; !ok {
+		s.order = append(s.order, callback.Reference)
+	}
+	s.callbacks[callback.Reference] = callback
+
+	return nil
+}
+
+// The callback registered for a user's reference code, if any
+func (s *ReusableSession) Lookup(reference string) (DocuPassIdentityCallback, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	callback, ok := s.callbacks[reference]
+
+	return callback, ok
+}
+
+// Every registered callback, in the order their references were first registered
+func (s *ReusableSession) Completions() []DocuPassIdentityCallback {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	completions := make([]DocuPassIdentityCallback, 0, len(s.order))
+	for _, reference := range s.order {
+		completions = append(completions, s.callbacks[reference])
+	}
+
+	return completions
+}
+
 type DocuPassValidationResponse struct {
 	Error     *APIError `json:"error,omitempty"`
 	Success   bool      `json:"success,omitempty"`
 	Reference string    `json:"reference,omitempty"`
+	RequestID string    `json:"-"` // Request ID from the API server's response headers, for support tickets; empty if the server sent none
 }
 
-func NewDocuPassAPI(apiKey, companyName, region string) (DocuPassAPI, error) {
+func NewDocuPassAPI(apiKey, companyName, region string, opts ...ClientOption) (DocuPassAPI, error) {
 	if apiKey == "" {
 		return DocuPassAPI{}, errors.New("please provide an API key")
 	}
@@ -103,23 +316,59 @@ func NewDocuPassAPI(apiKey, companyName, region string) (DocuPassAPI, error) {
 		return DocuPassAPI{}, errors.New("please provide your company name")
 	}
 
+	client, err := newAPIClient(apiKey, region, "docupass")
+	if err != nil {
+		return DocuPassAPI{}, err
+	}
+
 	api := DocuPassAPI{
-		apiKey:      apiKey,
-		apiEndpoint: endpointFromRegion(region, "docupass"),
+		apiClient:   client,
 		companyName: companyName,
 		config:      defaultDocuPassConfig,
 	}
 
+	for _, opt := range opts {
+		if err := opt(&api.apiClient); err != nil {
+			return DocuPassAPI{}, err
+		}
+	}
+
 	return api, nil
 }
 
 // SETTERS
+//
+// Passing an empty string to a string setter (VerifyName, VerifyDOB, RestrictCountry, SetLogo, etc.) clears just
+// that setting; use ResetConfig to clear everything
 
 // Reset all API configurations except API key, company name, and region
 func (d *DocuPassAPI) ResetConfig() {
 	d.config = defaultDocuPassConfig
 }
 
+// Set the maximum callback body size in bytes accepted by ParseIdentityCallback and ParseSignatureCallback
+// Set to 0 to restore the default: 1MB, or 64MB while SetCallbackImage has DocuPass send base64 images in callbacks
+func (d *DocuPassAPI) SetCallbackMaxSize(size int64) error {
+	if size < 0 {
+		return errors.New("invalid callback size; must not be negative")
+	}
+	d.callbackMaxSize = size
+
+	return nil
+}
+
+// Set a default timeout for API requests, applied whenever the request context has no deadline of its own
+// Set to 0 to disable the default timeout
+func (d *DocuPassAPI) SetTimeout(timeout time.Duration) {
+	d.timeout = timeout
+}
+
+// Send requests to endpoint verbatim, instead of the endpoint chosen by region, e.g. a mock server or on-premise deployment
+// Only http and https URLs are accepted, and any trailing slash is removed
+func (d *DocuPassAPI) SetEndpoint(endpoint string) error {
+	return d.setEndpoint(endpoint)
+}
+
 // Set max verification attempt per user
 // Must be between 1 and 10, inclusive
 func (d *DocuPassAPI) SetMaxAttempt(maxAttempt uint) error {
@@ -167,18 +416,25 @@ func (d *DocuPassAPI) SetLanguage(lang string) {
 
 // Set server-side callback/webhook URL to receive verification results
 func (d *DocuPassAPI) SetCallbackUrl(callback string) error {
-	if uri, err := url.ParseRequestURI(callback); err != nil {
-		return errors.New("invalid URL format")
-	} else if ip := net.ParseIP(uri.Host); (ip != nil && isPrivateIP(ip)) || strings.ToLower(uri.Host) == "localhost" {
-		return errors.New("invalid URL, the host does not appear to be a remote host")
-	} else if uri.Scheme != "http" && uri.Scheme != "https" {
-		return errors.New("invalid URL, only http and https protocols are allowed")
+	if err := validateCallbackUrl(callback); err != nil {
+		return err
 	}
 	d.config.callbackUrl = callback
 
 	return nil
 }
 
+// Add an extra URL that verified callbacks will be re-posted to by ParseIdentityCallback and ParseSignatureCallback
+// DocuPass itself only delivers to the single URL set with SetCallbackUrl, so forwarding happens from your own server
+func (d *DocuPassAPI) AddCallbackForward(forward string) error {
+	if err := validateCallbackUrl(forward); err != nil {
+		return err
+	}
+	d.config.callbackForwards = append(d.config.callbackForwards, forward)
+
+	return nil
+}
+
 // Redirect client browser to set URLs after verification
 // DocuPass reference code and customid will be appended to the end of URL, e.g. https://www.example.com/success.php?reference=XXXXXXXX&customid=XXXXXXXX
 func (d *DocuPassAPI) SetRedirectURL(successUrl, failUrl string) error {
@@ -232,8 +488,46 @@ func (d *DocuPassAPI) EnableFaceVerification(enabled bool, verificationType uint
 	return nil
 }
 
+// Attach already-captured document images (URL, file path or base64 content) to the session, e.g. to re-verify a known document
+// back may be "" for single-sided documents; pass "" for both to remove the images
+func (d *DocuPassAPI) SetDocument(front, back string) error {
+	if front == "" && back != "" {
+		return errors.New("front document image required with a back image")
+	}
+
+	frontUrl, frontContent, err := resolveDocuPassImage(front)
+	if err != nil {
+		return fmt.Errorf("invalid front document image: %s", err.Error())
+	}
+	backUrl, backContent, err := resolveDocuPassImage(back)
+	if err != nil {
+		return fmt.Errorf("invalid back document image: %s", err.Error())
+	}
+
+	d.config.documentUrl = frontUrl
+	d.config.documentBase64 = frontContent
+	d.config.documentBackUrl = backUrl
+	d.config.documentBackBase64 = backContent
+
+	return nil
+}
+
+// Compare the user's selfie against a known photo of them (URL, file path or base64 content), instead of the document photo
+// Use this when matching a new selfie against a photo from an earlier verification; pass "" to remove the photo
+func (d *DocuPassAPI) SetReferenceFace(image string) error {
+	url, content, err := resolveDocuPassImage(image)
+	if err != nil {
+		return fmt.Errorf("invalid reference face image: %s", err.Error())
+	}
+	d.config.faceUrl = url
+	d.config.faceBase64 = content
+
+	return nil
+}
+
 // Enabling this parameter will allow multiple users to verify their identity through the same URL
 // A new DocuPass reference code will be generated for each user automatically
+// NOTE: the DocuPass API has no parameter for session lifetime; links stay valid until the Expiry returned on creation
 func (d *DocuPassAPI) SetReusable(enabled bool) {
 	d.config.reusable = enabled
 }
@@ -271,6 +565,28 @@ func (d *DocuPassAPI) SetQRCodeFormat(fore, back string, size, margin uint) erro
 	return nil
 }
 
+// Set the QR code colors from color.Color values, keeping the current size and margin
+// The API only takes RGB colors, so colors that aren't fully opaque are rejected
+func (d *DocuPassAPI) SetQRCodeColors(fore, back color.Color) error {
+	foreHex, err := qrColorHex(fore)
+	if err != nil {
+		return fmt.Errorf("invalid foreground color: %s", err.Error())
+	}
+	backHex, err := qrColorHex(back)
+	if err != nil {
+		return fmt.Errorf("invalid background color: %s", err.Error())
+	}
+	d.config.qrColor = foreHex
+	d.config.qrBgColor = backHex
+
+	return nil
+}
+
+// Automatically detect and crop the document from the user's photo before it is processed and stored
+func (d *DocuPassAPI) SetCropDocument(enabled bool) {
+	d.config.cropDocument = enabled
+}
+
 // Check if the names, document number and document type matches
 // between the front and the back of the document when performing dual-side scan
 // If any information mismatches error 14 will be thrown
@@ -340,9 +656,13 @@ func (d *DocuPassAPI) VerifyName(name string) {
 }
 
 // Check if supplied date of birth matches with document
+// Both YYYY/MM/DD and YYYY-MM-DD are accepted; the date is sent to the API as YYYY/MM/DD
 func (d *DocuPassAPI) VerifyDOB(date string) error {
-	if _, err := time.Parse("2006/01/02", date); err != nil && date != "" {
-		return errors.New("invalid birthday format (YYYY/MM/DD)")
+	if date != "" {
+		var err error
+		if date, err = normalizeDOB(date); err != nil {
+			return err
+		}
 	}
 	d.config.verifyDOB = date
 
@@ -369,6 +689,29 @@ func (d *DocuPassAPI) VerifyPostcode(postcode string) {
 	d.config.verifyPostcode = postcode
 }
 
+// Configure several verifications at once, for example from a config file
+// Keys are "name", "dob", "age", "address", "postcode", "phone", "documentnumber" and "expiry" (with a value of "true" or "false")
+// Each value is validated as by the matching Verify setter, and nothing changes unless every entry is valid
+func (d *DocuPassAPI) SetVerifications(verifications map[string]string) error {
+	staged := *d
+	err := applyVerifications(verifications, map[string]func(string) error{
+		"name":           func(value string) error { staged.VerifyName(value); return nil },
+		"dob":            staged.VerifyDOB,
+		"age":            staged.VerifyAge,
+		"address":        func(value string) error { staged.VerifyAddress(value); return nil },
+		"postcode":       func(value string) error { staged.VerifyPostcode(value); return nil },
+		"phone":          func(value string) error { staged.VerifyPhone(value); return nil },
+		"documentnumber": func(value string) error { staged.VerifyDocumentNumber(value); return nil },
+		"expiry":         func(value string) error { return verificationBool(value, staged.VerifyExpiry) },
+	})
+	if err != nil {
+		return err
+	}
+	d.config = staged.config
+
+	return nil
+}
+
 // Check if the document was issued by specified countries
 // If not error code 10 will be thrown
 // Separate multiple values with comma
@@ -407,10 +750,14 @@ func (d *DocuPassAPI) GenerateContract(templateID, format string, prefillData ma
 	if format != "PDF" && format != "DOCX" && format != "HTML" {
 		return errors.New(`invalid format; must be "PDF", "DOCX", or "HTML"`)
 	}
+	prefill, err := validatePrefillData(prefillData)
+	if err != nil {
+		return err
+	}
 	d.config.contractGenerate = templateID
 	d.config.contractSign = ""
 	d.config.contractFormat = format
-	d.config.contractPrefillData = prefillData
+	d.config.contractPrefillData = prefill
 
 	return nil
 }
@@ -426,34 +773,56 @@ func (d *DocuPassAPI) SignContract(templateID, format string, prefillData map[st
 	if format != "PDF" && format != "DOCX" && format != "HTML" {
 		return errors.New(`invalid format; must be "PDF", "DOCX", or "HTML"`)
 	}
+	prefill, err := validatePrefillData(prefillData)
+	if err != nil {
+		return err
+	}
 	d.config.contractGenerate = ""
 	d.config.contractSign = templateID
 	d.config.contractFormat = format
-	d.config.contractPrefillData = prefillData
+	d.config.contractPrefillData = prefill
 
 	return nil
 }
 
 // ACTIONS
 
+// Get the JSON request that the current configuration would send when creating a session
+// The API key is left blank, so the output is safe to log, diff or store
+func (d *DocuPassAPI) ConfigJSON() ([]byte, error) {
+	payload := d.requestFromConfig()
+	payload.ApiKey = ""
+
+	return json.Marshal(payload)
+}
+
+// Create a DocuPass identity verification session of the given type, e.g. one chosen in your own configuration
+func (d *DocuPassAPI) Create(mode DocuPassType) (DocuPassIdentityResponse, error) {
+	if _, ok := docuPassTypeNames[mode]; !ok {
+		return DocuPassIdentityResponse{}, fmt.Errorf("unknown DocuPass session type %d", mode)
+	}
+
+	return d.create(mode)
+}
+
 // Create a DocuPass identity verification session for embedding in web page as iframe
 func (d *DocuPassAPI) CreateIFrame() (DocuPassIdentityResponse, error) {
-	return d.create(0)
+	return d.create(DocuPassTypeIFrame)
 }
 
 // Create a DocuPass identity verification session for users to open on mobile phone, or embedding in mobile app
 func (d *DocuPassAPI) CreateMobile() (DocuPassIdentityResponse, error) {
-	return d.create(1)
+	return d.create(DocuPassTypeMobile)
 }
 
 // Create a DocuPass identity verification session for users to open in any browser
 func (d *DocuPassAPI) CreateRedirection() (DocuPassIdentityResponse, error) {
-	return d.create(2)
+	return d.create(DocuPassTypeRedirection)
 }
 
 // Create a DocuPass Live Mobile identity verification session for users to open on mobile phone
 func (d *DocuPassAPI) CreateLiveMobile() (DocuPassIdentityResponse, error) {
-	return d.create(3)
+	return d.create(DocuPassTypeLiveMobile)
 }
 
 // Create a DocuPass signature session for user to review and sign legal document without identity verification
@@ -461,30 +830,83 @@ func (d *DocuPassAPI) CreateLiveMobile() (DocuPassIdentityResponse, error) {
 // format: Output file format: PDF, DOCX or HTML
 // prefillData: JSON-encodable data to autofill dynamic fields in contract template
 func (d *DocuPassAPI) CreateSignature(templateID, format string, prefillData map[string]interface{}) (DocuPassSignatureResponse, error) {
+	prefill, err := validatePrefillData(prefillData)
+	if err != nil {
+		return DocuPassSignatureResponse{}, err
+	}
+
 	payload := d.requestFromConfig()
 	payload.TemplateID = templateID
 	payload.ContractFormat = format
-	payload.ContractPrefillData = prefillData
+	payload.ContractPrefillData = prefill
 
-	body, _ := json.Marshal(payload)
+	ctx, cancel := withDefaultTimeout(context.Background(), d.timeout)
+	defer cancel()
 
-	if response, err := http.Post(fmt.Sprintf("%s/sign", d.apiEndpoint), "application/json", bytes.NewBuffer(body)); err != nil {
-		return DocuPassSignatureResponse{}, fmt.Errorf("failed to connect to API server: %s", err.Error())
-	} else {
-		var result DocuPassSignatureResponse
+	var result DocuPassSignatureResponse
+	raw, err := d.doJSON(ctx, fmt.Sprintf("%s/sign", d.apiEndpoint), payload, &result)
+	result.RawResponse = raw
+	if err != nil {
+		return result, err
+	}
 
-		body, _ := io.ReadAll(response.Body)
-		json.Unmarshal(body, &result)
+	if result.Error != nil && result.Error.Message != "" {
+		return result, result.Error
+	}
 
-		if result.Error != nil && result.Error.Message != "" {
-			return result, fmt.Errorf("%d: %s", result.Error.Code, result.Error.Message)
-		}
+	return result, nil
+}
+
+// Check whether a session has finished, for servers that can't receive callbacks (e.g. behind a firewall during development)
+// DocuPass has no status endpoint, so this looks for the vault entry the session saves when it finishes;
+// it only works while EnableVault is on (the default), and a session stays pending if it expires unfinished
+func (d *DocuPassAPI) GetSessionStatus(reference string) (DocuPassSessionStatus, error) {
+	return d.GetSessionStatusContext(context.Background(), reference)
+}
+
+// Check whether a session has finished, bounded by ctx
+func (d *DocuPassAPI) GetSessionStatusContext(ctx context.Context, reference string) (DocuPassSessionStatus, error) {
+	if matched, _ := regexp.MatchString(`^[A-Za-z0-9]+$`, reference); !matched {
+		return DocuPassSessionStatus{}, errors.New("invalid DocuPass reference")
+	}
+	if !strings.HasSuffix(d.apiEndpoint, "/docupass") {
+		return DocuPassSessionStatus{}, errors.New("cannot find the Vault API for a custom DocuPass endpoint")
+	}
+
+	vault := VaultAPI{apiClient: d.apiClient}
+	vault.apiEndpoint = strings.TrimSuffix(d.apiEndpoint, "docupass") + "vault"
+	vault.apiPath = "vault"
+
+	filter, err := NewVaultFilter().Equals("docupass_reference", reference).Build()
+	if err != nil {
+		return DocuPassSessionStatus{}, err
+	}
+	list, err := vault.ListContext(ctx, filter, "createtime", "DESC", 1, 0)
+	if err != nil {
+		return DocuPassSessionStatus{}, err
+	}
 
-		return result, nil
+	status := DocuPassSessionStatus{
+		Reference: reference,
+		State:     DocuPassSessionPending,
 	}
+	if len(list.Items) > 0 {
+		status.Entry = &list.Items[0]
+		if status.Entry.DocuPassSuccess == 1 {
+			status.State = DocuPassSessionSucceeded
+		} else {
+			status.State = DocuPassSessionFailed
+			status.FailReason = status.Entry.DocuPassFailedReason
+		}
+	}
+
+	return status, nil
 }
 
-//
+// Check a reference/hash pair from a DocuPass callback against the DocuPass server
+// Returns false with a nil error when the server answered and the pair is not valid;
+// an error means the check itself failed, and is an *APIError when the server reported one
+// NOTE: there is no local alternative; DocuPass doesn't document how the hash is derived, so only its server can check it
 func (d *DocuPassAPI) Validate(reference, hash string) (bool, error) {
 	payload := map[string]string{
 		"apikey":    d.apiKey,
@@ -492,18 +914,77 @@ func (d *DocuPassAPI) Validate(reference, hash string) (bool, error) {
 		"hash":      hash,
 	}
 
-	body, _ := json.Marshal(payload)
+	ctx, cancel := withDefaultTimeout(context.Background(), d.timeout)
+	defer cancel()
 
-	if response, err := http.Post(fmt.Sprintf("%s/validate", d.apiEndpoint), "application/json", bytes.NewBuffer(body)); err != nil {
-		return false, fmt.Errorf("failed to connect to API server: %s", err.Error())
-	} else {
-		var result DocuPassValidationResponse
+	var result DocuPassValidationResponse
+	if _, err := d.doJSON(ctx, fmt.Sprintf("%s/validate", d.apiEndpoint), payload, &result); err != nil {
+		return false, err
+	}
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.Success, nil
+}
+
+// Check that a reference/hash pair from a DocuPass callback was issued for this account
+// The pair is verified against the DocuPass server using your API key, and an error is returned if it does not match
+func (d *DocuPassAPI) VerifyCallback(reference, hash string) error {
+	if reference == "" || hash == "" {
+		return errors.New("invalid callback, reference and hash required")
+	}
+
+	if valid, err := d.Validate(reference, hash); err != nil {
+		return err
+	} else if !valid {
+		return errors.New("callback failed validation against DocuPass server")
+	}
+
+	return nil
+}
+
+// Parse an identity verification callback POSTed by DocuPass to your callback URL, and verify its authenticity
+// Requests that aren't JSON POSTs (ErrCallbackContentType), bodies over the SetCallbackMaxSize limit (ErrCallbackTooLarge),
+// and reference/hash pairs that fail verification are rejected
+// Once verified, the body is re-posted verbatim to every URL added with AddCallbackForward, bounded by the request's context;
+// if any forward fails, the callback is still returned, along with an ErrCallbackForward error
+func (d *DocuPassAPI) ParseIdentityCallback(r *http.Request) (*DocuPassIdentityCallback, error) {
+	var callback DocuPassIdentityCallback
+
+	body, err := d.readCallback(r, &callback)
+	if err != nil {
+		return nil, err
+	}
+	callback.RawBody = body
+	if err = d.VerifyCallback(callback.Reference, callback.Hash); err != nil {
+		return nil, err
+	}
+	if err = d.forwardCallbacks(r.Context(), body); err != nil {
+		return &callback, err
+	}
+
+	return &callback, nil
+}
 
-		body, _ := io.ReadAll(response.Body)
-		json.Unmarshal(body, &result)
+// Parse a signature callback POSTed by DocuPass to your callback URL, and verify its authenticity
+// The same checks as ParseIdentityCallback apply
+func (d *DocuPassAPI) ParseSignatureCallback(r *http.Request) (*DocuPassSignatureCallback, error) {
+	var callback DocuPassSignatureCallback
 
-		return result.Success, nil
+	body, err := d.readCallback(r, &callback)
+	if err != nil {
+		return nil, err
+	}
+	callback.RawBody = body
+	if err = d.VerifyCallback(callback.Reference, callback.Hash); err != nil {
+		return nil, err
 	}
+	if err = d.forwardCallbacks(r.Context(), body); err != nil {
+		return &callback, err
+	}
+
+	return &callback, nil
 }
 
 // PRIVATE
@@ -516,6 +997,7 @@ type docuPassConfig struct {
 	authenticateModule   string
 	biometric            uint
 	biometricThreshold   float32
+	callbackForwards     []string
 	callbackUrl          string
 	contractFormat       string
 	contractGenerate     string
@@ -524,11 +1006,17 @@ type docuPassConfig struct {
 	cropDocument         bool
 	customHtmlUrl        string
 	customID             string
+	documentBackBase64   string
+	documentBackUrl      string
+	documentBase64       string
 	documentCountry      string
 	documentRegion       string
 	documentType         string
+	documentUrl          string
 	dualSideCheck        bool
 	failRedir            string
+	faceBase64           string
+	faceUrl              string
 	language             string
 	logo                 string
 	maxAttempt           uint
@@ -603,7 +1091,7 @@ type docuPassRequest struct {
 	SMSVerificationLink  string                 `json:"sms_verification_link"`
 	SuccessRedir         string                 `json:"successredir"`
 	TemplateID           string                 `json:"template_id,omitempty"`
-	Type                 uint                   `json:"type"`
+	Type                 DocuPassType           `json:"type"`
 	VaultSave            bool                   `json:"vault_save"`
 	VerifyAddress        string                 `json:"verify_address"`
 	VerifyAge            string                 `json:"verify_age"`
@@ -625,6 +1113,7 @@ var defaultDocuPassConfig = docuPassConfig{
 	authenticateModule:   "2",
 	biometric:            0,
 	biometricThreshold:   0.4,
+	callbackForwards:     nil,
 	callbackUrl:          "",
 	contractFormat:       "",
 	contractGenerate:     "",
@@ -685,11 +1174,17 @@ func (d *DocuPassAPI) requestFromConfig() docuPassRequest {
 		CropDocument:         d.config.cropDocument,
 		CustomHtmlUrl:        d.config.customHtmlUrl,
 		CustomID:             d.config.customID,
+		DocumentBase64:       d.config.documentBase64,
+		DocumentBackBase64:   d.config.documentBackBase64,
+		DocumentBackURL:      d.config.documentBackUrl,
 		DocumentCountry:      d.config.documentCountry,
 		DocumentRegion:       d.config.documentRegion,
 		DocumentType:         d.config.documentType,
+		DocumentURL:          d.config.documentUrl,
 		DualSideCheck:        d.config.dualSideCheck,
 		FailRedir:            d.config.failRedir,
+		FaceBase64:           d.config.faceBase64,
+		FaceURL:              d.config.faceUrl,
 		Language:             d.config.language,
 		Logo:                 d.config.logo,
 		MaxAttempt:           d.config.maxAttempt,
@@ -716,28 +1211,263 @@ func (d *DocuPassAPI) requestFromConfig() docuPassRequest {
 		VerifyPhone:          d.config.verifyPhone,
 		VerifyPostcode:       d.config.verifyPostcode,
 		WelcomeMessage:       d.config.welcomeMessage,
-		Client:               "go-sdk",
+		Client:               d.client(),
 	}
 }
 
-func (d *DocuPassAPI) create(mode uint) (DocuPassIdentityResponse, error) {
+func (d *DocuPassAPI) create(mode DocuPassType) (DocuPassIdentityResponse, error) {
 	payload := d.requestFromConfig()
 	payload.Type = mode
 
-	body, _ := json.Marshal(payload)
+	ctx, cancel := withDefaultTimeout(context.Background(), d.timeout)
+	defer cancel()
+
+	var result DocuPassIdentityResponse
+	raw, err := d.doJSON(ctx, fmt.Sprintf("%s/create", d.apiEndpoint), payload, &result)
+	result.RawResponse = raw
+	if err != nil {
+		return result, err
+	}
+
+	if result.Error != nil && result.Error.Message != "" {
+		return result, result.Error
+	}
+
+	return result, nil
+}
+
+// Classify an image string as a URL, file or base64 content the way Core scans do, returning its URL or base64 content
+func resolveDocuPassImage(image string) (string, string, error) {
+	if image == "" {
+		return "", "", nil
+	}
+
+	input, ok := DetectImageInput(image)
+	if !ok {
+		return "", "", errors.New("file not found or malformed URL")
+	}
+
+	return input.resolve(0)
+}
+
+// Descriptions of failed verification checks, keyed by their JSON names in APIVerificationResult
+var docuPassCheckDescriptions = map[string]string{
+	"checkdigit":     "MRZ check digit is invalid",
+	"face":           "face does not match the document photo",
+	"notexpired":     "document has expired",
+	"documentNumber": "document number does not match",
+	"name":           "name does not match",
+	"age":            "age is outside the accepted range",
+	"dob":            "date of birth does not match",
+	"address":        "address does not match",
+	"postcode":       "postcode does not match",
+}
+
+// Convert an opaque color to the 6 digit HEX code the API expects for QR code colors
+func qrColorHex(c color.Color) (string, error) {
+	if c == nil {
+		return "", errors.New("color required")
+	}
+	r, g, b, a := c.RGBA()
+	if a != 0xffff {
+		return "", errors.New("color must be fully opaque")
+	}
+
+	return fmt.Sprintf("%02x%02x%02x", r>>8, g>>8, b>>8), nil
+}
+
+// Expiry is normally a Unix timestamp in seconds, but date-time strings are accepted too
+func parseDocuPassExpiry(expiry string) (time.Time, error) {
+	expiry = strings.TrimSpace(expiry)
+	if expiry == "" {
+		return time.Time{}, errors.New("no expiry returned")
+	}
+
+	if seconds, err := strconv.ParseInt(expiry, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006/01/02 15:04:05"} {
+		if parsed, err := time.Parse(layout, expiry); err == nil {
+			return parsed, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid expiry %q", expiry)
+}
+
+// SMSSent is empty when no SMS was requested; otherwise it holds the number the link was sent to, or a yes/no flag
+func docuPassSMSSent(sent string) bool {
+	switch strings.ToLower(strings.TrimSpace(sent)) {
+	case "", "0", "no", "false":
+		return false
+	default:
+		return true
+	}
+}
+
+const maxQRCodeSize int64 = 1 << 20
 
-	if response, err := http.Post(fmt.Sprintf("%s/create", d.apiEndpoint), "application/json", bytes.NewBuffer(body)); err != nil {
-		return DocuPassIdentityResponse{}, fmt.Errorf("failed to connect to API server: %s", err.Error())
+func docuPassQRCode(ctx context.Context, client *http.Client, qrCode string) ([]byte, error) {
+	var data []byte
+
+	if strings.HasPrefix(qrCode, "data:") {
+		_, content, err := Base64Input(qrCode).resolve(0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid QR code: %s", err.Error())
+		}
+		data, _ = base64.StdEncoding.DecodeString(content)
+	} else if isRemoteURL(qrCode) {
+		var err error
+		if data, _, err = download(ctx, client, qrCode, maxQRCodeSize); err != nil {
+			return nil, fmt.Errorf("failed to download QR code: %w", err)
+		}
 	} else {
-		var result DocuPassIdentityResponse
+		return nil, errors.New("no QR code returned")
+	}
+
+	if int64(len(data)) > maxQRCodeSize || http.DetectContentType(data) != "image/png" {
+		return nil, errors.New("QR code is not a PNG image")
+	}
+
+	return data, nil
+}
+
+var iframeAttributes = map[string]bool{
+	"width":          true,
+	"height":         true,
+	"sandbox":        true,
+	"allow":          true,
+	"title":          true,
+	"loading":        true,
+	"referrerpolicy": true,
+	"class":          true,
+	"id":             true,
+	"name":           true,
+}
+
+func docuPassIFrame(session string, attrs map[string]string) (template.HTML, error) {
+	if uri, err := url.Parse(session); err != nil || (uri.Scheme != "https" && uri.Scheme != "http") || uri.Host == "" {
+		return "", errors.New("invalid session URL")
+	}
+
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		if !iframeAttributes[strings.ToLower(name)] {
+			return "", fmt.Errorf("iframe attribute %q not allowed", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var tag strings.Builder
+	tag.WriteString(`<iframe src="`)
+	tag.WriteString(html.EscapeString(session))
+	tag.WriteString(`"`)
+	for _, name := range names {
+		tag.WriteString(fmt.Sprintf(` %s="%s"`, strings.ToLower(name), html.EscapeString(attrs[name])))
+	}
+	tag.WriteString(`></iframe>`)
+
+	return template.HTML(tag.String()), nil
+}
+
+const (
+	defaultCallbackMaxSize      int64 = 1 << 20
+	defaultImageCallbackMaxSize int64 = 64 << 20
+)
+
+// Re-post a verified callback body to every forward URL concurrently, attempting each even if another one fails
+// Forwards go through a plain HTTP client, not the API client, and each times out after 30 seconds
+func (d *DocuPassAPI) forwardCallbacks(ctx context.Context, body []byte) error {
+	forwards := d.config.callbackForwards
+	errs := make([]error, len(forwards))
+	var wg sync.WaitGroup
+	for index, forward := range forwards {
+		wg.Add(1)
+		go func(index int, forward string) {
+			defer wg.Done()
+			errs[index] = forwardCallback(ctx, forward, body)
+		}(index, forward)
+	}
+	wg.Wait()
+
+	var failed []string
+	for index, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%s)", forwards[index], err.Error()))
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%w to %s", ErrCallbackForward, strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+// Callbacks are forwarded outside of the API client, so its rate limit, idempotency keys and User-Agent don't apply
+var callbackForwardClient = &http.Client{Timeout: 30 * time.Second}
+
+func forwardCallback(ctx context.Context, forward string, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, forward, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
 
-		body, _ := io.ReadAll(response.Body)
-		json.Unmarshal(body, &result)
+	response, err := callbackForwardClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return errors.New(response.Status)
+	}
 
-		if result.Error != nil && result.Error.Message != "" {
-			return result, fmt.Errorf("%d: %s", result.Error.Code, result.Error.Message)
+	return nil
+}
+
+// Whether err came from reading past an http.MaxBytesReader limit
+// *http.MaxBytesError only exists from Go 1.19, so it is matched by name; earlier versions return a plain error with the same message
+func isMaxBytesError(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if reflect.TypeOf(err).String() == "*http.MaxBytesError" || err.Error() == "http: request body too large" {
+			return true
 		}
+	}
+
+	return false
+}
+
+// Read and decode a callback request, returning the raw body
+func (d *DocuPassAPI) readCallback(r *http.Request, callback interface{}) ([]byte, error) {
+	if r.Method != http.MethodPost {
+		return nil, fmt.Errorf("%w, got method %s", ErrCallbackContentType, r.Method)
+	}
 
-		return result, nil
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		return nil, fmt.Errorf("%w, got content type %q", ErrCallbackContentType, r.Header.Get("Content-Type"))
 	}
+
+	limit := d.callbackMaxSize
+	if limit == 0 {
+		limit = defaultCallbackMaxSize
+		if (d.config.returnDocumentImage || d.config.returnFaceImage) && d.config.returnType == 0 {
+			limit = defaultImageCallbackMaxSize
+		}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, limit))
+	if isMaxBytesError(err) {
+		return nil, fmt.Errorf("%w, limit is %d bytes", ErrCallbackTooLarge, limit)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read callback body: %s", err.Error())
+	}
+
+	if err = json.Unmarshal(body, callback); err != nil {
+		return nil, fmt.Errorf("failed to parse callback body: %w", err)
+	}
+
+	return body, nil
 }
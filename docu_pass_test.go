@@ -0,0 +1,174 @@
+package idanalyzer_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/danhunsaker/idanalyzer-go-sdk"
+	"github.com/danhunsaker/idanalyzer-go-sdk/idanalyzertest"
+)
+
+func TestQRCodePNGSizeLimit(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/large.png" {
+			w.Write(append(png, bytes.Repeat([]byte{0}, 2<<20)...))
+			return
+		}
+		w.Write(png)
+	}))
+	defer server.Close()
+
+	response := idanalyzer.DocuPassIdentityResponse{QRCode: server.URL + "/qr.png"}
+	if data, err := response.QRCodePNG(context.Background(), server.Client()); err != nil || !bytes.Equal(data, png) {
+		t.Errorf("expected the PNG, got %q, %v", data, err)
+	}
+
+	response.QRCode = server.URL + "/large.png"
+	if _, err := response.QRCodePNG(context.Background(), server.Client()); err == nil {
+		t.Error("expected an error for a QR code over the size limit")
+	}
+}
+
+func TestCallbackSizeLimit(t *testing.T) {
+	docuPass, err := idanalyzer.NewDocuPassAPI("key", "Company", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := docuPass.SetCallbackMaxSize(64); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"reference":"ABC"}`
+	for size, wantTooLarge := range map[int]bool{64: false, 65: true} {
+		request := httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(body+strings.Repeat(" ", size-len(body))))
+		request.Header.Set("Content-Type", "application/json")
+
+		_, err := docuPass.ParseIdentityCallback(request)
+		if tooLarge := errors.Is(err, idanalyzer.ErrCallbackTooLarge); tooLarge != wantTooLarge {
+			t.Errorf("%d byte body: expected too large %v, got %v", size, wantTooLarge, err)
+		}
+	}
+}
+
+func TestFailedVerificationsListsOnlyReturnedChecks(t *testing.T) {
+	server := idanalyzertest.NewServer(map[string]http.Handler{
+		idanalyzertest.PathDocuPassValidate: idanalyzertest.JSON(idanalyzertest.DocuPassValidationSuccess()),
+	})
+	defer server.Close()
+
+	docuPass, err := idanalyzer.NewDocuPassAPI("key", "Company", "", server.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"success":false,"reference":"ABC","hash":"0123","failcode":"99","failreason":"Document rejected",` +
+		`"verification":{"passed":false,"result":{"face":false,"notexpired":true}}}`
+	request := httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+
+	callback, err := docuPass.ParseIdentityCallback(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(callback.RawBody) != body {
+		t.Errorf("expected the raw body to be kept, got %q", callback.RawBody)
+	}
+
+	want := []string{"Document rejected", "face does not match the document photo"}
+	if got := callback.FailedVerifications(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestParseCallbackForwardsOnce(t *testing.T) {
+	var validations int32
+	var userAgent, forwarded string
+	server := idanalyzertest.NewServer(map[string]http.Handler{
+		idanalyzertest.PathDocuPassValidate: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&validations, 1)
+			idanalyzertest.JSON(idanalyzertest.DocuPassValidationSuccess()).ServeHTTP(w, r)
+		}),
+		"/audit": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userAgent = r.Header.Get("User-Agent")
+			body, _ := io.ReadAll(r.Body)
+			forwarded = string(body)
+		}),
+		"/broken": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}),
+	})
+	defer server.Close()
+
+	docuPass, err := idanalyzer.NewDocuPassAPI("key", "Company", "", server.Option(), idanalyzer.WithUserAgent("app/1.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, forward := range []string{server.URL + "/audit", server.URL + "/broken"} {
+		if err := docuPass.AddCallbackForward(forward); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	body := `{"reference":"ABC","hash":"0123"}`
+	request := httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+
+	callback, err := docuPass.ParseIdentityCallback(request)
+	if !errors.Is(err, idanalyzer.ErrCallbackForward) || !strings.Contains(err.Error(), "/broken") || strings.Contains(err.Error(), "/audit") {
+		t.Errorf("expected only the broken forward to fail, got %v", err)
+	}
+	if callback == nil || callback.Reference != "ABC" {
+		t.Errorf("expected the verified callback alongside the forward error, got %+v", callback)
+	}
+	if validations != 1 {
+		t.Errorf("expected the callback to be validated once, got %d validations", validations)
+	}
+	if forwarded != body {
+		t.Errorf("expected the body to be forwarded verbatim, got %q", forwarded)
+	}
+	if strings.Contains(userAgent, "idanalyzer-go-sdk") {
+		t.Errorf("expected the forward to bypass the API client, got User-Agent %q", userAgent)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		want     bool
+		apiError bool
+	}{
+		{"valid", idanalyzertest.JSON(idanalyzertest.DocuPassValidationSuccess()), true, false},
+		{"not valid", idanalyzertest.JSON(idanalyzer.DocuPassValidationResponse{Success: false}), false, false},
+		{"API error", idanalyzertest.Error(idanalyzertest.ErrCountryRestricted()), false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := idanalyzertest.NewServer(map[string]http.Handler{idanalyzertest.PathDocuPassValidate: test.handler})
+			defer server.Close()
+
+			docuPass, err := idanalyzer.NewDocuPassAPI("key", "Company", "", server.Option())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			valid, err := docuPass.Validate("ABCDEFGHIJ", "0123")
+			var apiError *idanalyzer.APIError
+			if errors.As(err, &apiError) != test.apiError || (!test.apiError && err != nil) {
+				t.Errorf("expected API error %v, got %v", test.apiError, err)
+			}
+			if valid != test.want {
+				t.Errorf("expected valid %v, got %v", test.want, valid)
+			}
+		})
+	}
+}
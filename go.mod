@@ -1,3 +1,5 @@
 module github.com/danhunsaker/idanalyzer-go-sdk
 
 go 1.16
+
+require golang.org/x/time v0.3.0
@@ -0,0 +1,219 @@
+package idanalyzertest
+
+import (
+	"github.com/danhunsaker/idanalyzer-go-sdk"
+)
+
+// Every fixture is a function returning a fresh value, so a test can modify what it gets without affecting other tests
+
+// SUCCESS FIXTURES
+
+// A successful single-sided Core API scan of a fictional driver's license
+func CoreSuccess() idanalyzer.CoreResponse1Side {
+	return idanalyzer.CoreResponse1Side{
+		Result: &idanalyzer.APIIdentityData{
+			DocumentNumber:  "D1234567",
+			FirstName:       "JANE",
+			LastName:        "SAMPLE",
+			FullName:        "JANE SAMPLE",
+			DOB:             "1990/01/02",
+			DOBDay:          2,
+			DOBMonth:        1,
+			DOBYear:         1990,
+			Expiry:          "2099/01/02",
+			ExpiryDay:       2,
+			ExpiryMonth:     1,
+			ExpiryYear:      2099,
+			Age:             30,
+			Sex:             "F",
+			DocumentSide:    "FRONT",
+			DocumentType:    "D",
+			DocumentName:    "California Driver License",
+			IssuerOrgFull:   "United States",
+			IssuerOrgISO2:   "US",
+			IssuerOrgISO3:   "USA",
+			NationalityFull: "United States",
+			NationalityISO2: "US",
+			NationalityISO3: "USA",
+		},
+		ExecutionTime: 0.5,
+		ResponseID:    "00000000000000000000000000000000",
+		Quota:         100,
+		Credit:        100,
+	}
+}
+
+// A successfully created DocuPass identity verification session
+func DocuPassIdentitySuccess() idanalyzer.DocuPassIdentityResponse {
+	return idanalyzer.DocuPassIdentityResponse{
+		Reference: "ABCDEFGHIJ",
+		CustomID:  "customer-1",
+		URL:       "https://docupass.app/ABCDEFGHIJ",
+		QRCode:    "https://docupass.app/qr/ABCDEFGHIJ.png",
+		BaseURL:   "https://docupass.app/",
+		Expiry:    "4102444800",
+	}
+}
+
+// A successfully created DocuPass signature session
+func DocuPassSignatureSuccess() idanalyzer.DocuPassSignatureResponse {
+	return idanalyzer.DocuPassSignatureResponse{
+		Reference: "KLMNOPQRST",
+		CustomID:  "customer-1",
+		URL:       "https://docupass.app/sign/KLMNOPQRST",
+		QRCode:    "https://docupass.app/qr/KLMNOPQRST.png",
+		BaseURL:   "https://docupass.app/",
+		Expiry:    "4102444800",
+	}
+}
+
+// A DocuPass callback that validated successfully
+func DocuPassValidationSuccess() idanalyzer.DocuPassValidationResponse {
+	return idanalyzer.DocuPassValidationResponse{
+		Success:   true,
+		Reference: "ABCDEFGHIJ",
+	}
+}
+
+// A single vault entry, as returned by Get
+func VaultItemSuccess() idanalyzer.VaultItemResponse {
+	return idanalyzer.VaultItemResponse{
+		Success: true,
+		Data:    vaultEntry(),
+	}
+}
+
+// A single page of vault entries, as returned by List
+func VaultListSuccess() idanalyzer.VaultListResponse {
+	return idanalyzer.VaultListResponse{
+		Limit: 10,
+		Total: 1,
+		Items: []idanalyzer.VaultData{*vaultEntry()},
+	}
+}
+
+// A successful vault update, delete or training request
+func VaultSuccess() idanalyzer.VaultSuccessResponse {
+	return idanalyzer.VaultSuccessResponse{
+		Success: 1,
+	}
+}
+
+// A single AML match for the fictional person in the other fixtures
+func AMLSuccess() idanalyzer.AMLResponse {
+	return idanalyzer.AMLResponse{
+		Items: []idanalyzer.AMLResponseItem{
+			{
+				Entity:      "person",
+				FullName:    []string{"JANE SAMPLE"},
+				DOB:         []string{"1990-01-02"},
+				Nationality: []string{"US"},
+				Database:    "us_ofac",
+			},
+		},
+	}
+}
+
+// An AML search matching the same fictional person on several sanction lists
+func AMLMultipleDatabases() idanalyzer.AMLResponse {
+	return idanalyzer.AMLResponse{
+		Items: []idanalyzer.AMLResponseItem{
+			{
+				Entity:      "person",
+				FullName:    []string{"JANE SAMPLE"},
+				DOB:         []string{"1990-01-02"},
+				Nationality: []string{"US"},
+				Database:    "us_ofac",
+			},
+			{
+				Entity:      "person",
+				FullName:    []string{"JANE SAMPLE"},
+				Nationality: []string{"US"},
+				Database:    "eu_fsf",
+			},
+			{
+				Entity:   "person",
+				FullName: []string{"JANE A SAMPLE"},
+				Alias:    []string{"JANE SAMPLE"},
+				Database: "us_ofac",
+			},
+			{
+				Entity:   "person",
+				FullName: []string{"JANE SAMPLE"},
+			},
+		},
+	}
+}
+
+// ERROR FIXTURES
+// Serve these with Error; the messages are examples, only the codes are meaningful
+
+func ErrInvalidAPIKey() idanalyzer.APIError {
+	return idanalyzer.APIError{
+		Code:    idanalyzer.ErrCodeInvalidAPIKey,
+		Message: "Invalid API key",
+	}
+}
+
+func ErrOutOfQuota() idanalyzer.APIError {
+	return idanalyzer.APIError{
+		Code:    idanalyzer.ErrCodeOutOfQuota,
+		Message: "Out of API quota",
+	}
+}
+
+func ErrDocumentNotRecognized() idanalyzer.APIError {
+	return idanalyzer.APIError{
+		Code:    idanalyzer.ErrCodeDocumentNotRecognized,
+		Message: "Failed to recognize document",
+	}
+}
+
+func ErrCountryRestricted() idanalyzer.APIError {
+	return idanalyzer.APIError{
+		Code:    idanalyzer.ErrCodeCountryRestricted,
+		Message: "Document issuing country is restricted",
+	}
+}
+
+func ErrStateRestricted() idanalyzer.APIError {
+	return idanalyzer.APIError{
+		Code:    idanalyzer.ErrCodeStateRestricted,
+		Message: "Document issuing state is restricted",
+	}
+}
+
+func ErrTypeRestricted() idanalyzer.APIError {
+	return idanalyzer.APIError{
+		Code:    idanalyzer.ErrCodeTypeRestricted,
+		Message: "Document type is restricted",
+	}
+}
+
+func ErrDualSideMismatch() idanalyzer.APIError {
+	return idanalyzer.APIError{
+		Code:    idanalyzer.ErrCodeDualSideMismatch,
+		Message: "Front and back of document do not match",
+	}
+}
+
+func ErrInvalidPhoneNumber() idanalyzer.APIError {
+	return idanalyzer.APIError{
+		Code:    idanalyzer.ErrCodeInvalidPhoneNumber,
+		Message: "Invalid phone number",
+	}
+}
+
+// PRIVATE
+
+// The fictional person in the other fixtures, as stored in the vault
+func vaultEntry() *idanalyzer.VaultData {
+	return &idanalyzer.VaultData{
+		ID:             "vault-1",
+		DocumentNumber: "D1234567",
+		FirstName:      "JANE",
+		LastName:       "SAMPLE",
+		FullName:       "JANE SAMPLE",
+		DOB:            "1990/01/02",
+	}
+}
@@ -0,0 +1,77 @@
+// Package idanalyzertest provides a fake ID Analyzer API server for testing code that uses the SDK
+package idanalyzertest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/danhunsaker/idanalyzer-go-sdk"
+)
+
+// Request paths served by each API, for use as keys in the handlers passed to NewServer
+const (
+	PathCore             = "/"
+	PathDocuPassCreate   = "/docupass/create"
+	PathDocuPassSign     = "/docupass/sign"
+	PathDocuPassValidate = "/docupass/validate"
+	PathVaultGet         = "/vault/get"
+	PathVaultList        = "/vault/list"
+	PathVaultUpdate      = "/vault/update"
+	PathVaultDelete      = "/vault/delete"
+	PathVaultAddImage    = "/vault/addimage"
+	PathVaultDeleteImage = "/vault/deleteimage"
+	PathVaultSearchFace  = "/vault/searchface"
+	PathVaultTrain       = "/vault/train"
+	PathVaultTrainStatus = "/vault/trainstatus"
+	PathAML              = "/aml"
+)
+
+// A fake ID Analyzer API, serving canned responses over HTTP
+// Close it when done, as with any httptest.Server
+type Server struct {
+	*httptest.Server
+}
+
+// Start a server answering each request path with its handler, and anything else with 404 Not Found
+// Use JSON and Error to build handlers from the fixtures in this package, or any http.Handler for custom behaviour
+func NewServer(handlers map[string]http.Handler) *Server {
+	return &Server{
+		Server: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler, ok := handlers[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+
+			handler.ServeHTTP(w, r)
+		})),
+	}
+}
+
+// Point a client at this server, e.g. idanalyzer.NewVaultAPI("key", "", server.Option())
+func (s *Server) Option() idanalyzer.ClientOption {
+	return idanalyzer.WithBaseURL(s.URL)
+}
+
+// Respond to every request with response encoded as JSON
+func JSON(response interface{}) http.Handler {
+	body, err := json.Marshal(response)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
+
+// Respond to every request with apiError, the way the API reports failures: a 200 OK with an error object
+func Error(apiError idanalyzer.APIError) http.Handler {
+	return JSON(map[string]interface{}{
+		"error": apiError,
+	})
+}
@@ -0,0 +1,113 @@
+package idanalyzer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// Runs the usual onboarding checks: a Core API document scan, then AML screening of the document holder
+type Onboarding struct {
+	core *CoreAPI
+	aml  *AMLAPI
+}
+
+// Returned by VerifyAndScreen when the scan failed verification, so AML screening was not run
+// The empty AMLResponse returned alongside it does not mean the holder is clear
+var ErrScreeningSkipped = errors.New("document failed verification, AML screening skipped")
+
+// Wire configured Core and AML clients together; each keeps its own settings, such as verifications and AML databases
+func NewOnboarding(core *CoreAPI, aml *AMLAPI) (*Onboarding, error) {
+	if core == nil || aml == nil {
+		return nil, errors.New("both a Core API and an AML API client are required")
+	}
+
+	return &Onboarding{
+		core: core,
+		aml:  aml,
+	}, nil
+}
+
+// ACTIONS
+
+// Scan documentPrimary, then screen the holder's name and document number against AML databases, bounded by ctx
+// The DOB and nationality read from the document narrow the AML search when present
+// If the scan returned verification results that did not pass, AML is skipped and ErrScreeningSkipped is returned
+// A non-fatal *CheckDigitError (PolicyWarn) doesn't stop screening, even though the failed check digits fail verification,
+// and is returned alongside the results when nothing else fails
+// Matches from both searches are combined into one AMLResponse without duplicates, though Total counts every item each search returned
+func (o *Onboarding) VerifyAndScreen(ctx context.Context, documentPrimary string) (CoreResponse1Side, AMLResponse, error) {
+	scan, warning := o.core.ScanFrontContext(ctx, documentPrimary)
+	if warning != nil {
+		var checkDigitError *CheckDigitError
+		if !errors.As(warning, &checkDigitError) || checkDigitError.Fatal {
+			return scan, AMLResponse{}, warning
+		}
+	}
+	if scan.Verification != nil && !scan.Verification.Passed {
+		failed := scan.FailedChecks()
+		if warning == nil || len(failed) != 1 || failed[0] != "checkdigit" {
+			return scan, AMLResponse{}, ErrScreeningSkipped
+		}
+	}
+	if scan.Result == nil {
+		return scan, AMLResponse{}, errors.New("scan returned no identity data to screen")
+	}
+	if scan.Result.FullName == "" && scan.Result.DocumentNumber == "" {
+		return scan, AMLResponse{}, errors.New("scan returned no name or document number to screen")
+	}
+
+	var dob string
+	if t, err := scan.Result.DOBTime(); err == nil {
+		dob = t.Format("2006-01-02")
+	}
+	country := scan.Result.NationalityISO2
+	if country == "" {
+		country = scan.Result.IssuerOrgISO2
+	}
+
+	var screening AMLResponse
+	if scan.Result.FullName != "" {
+		byName, err := o.aml.SearchByNameContext(ctx, scan.Result.FullName, country, dob)
+		if err != nil {
+			return scan, byName, err
+		}
+		mergeAMLResponse(&screening, byName)
+	}
+	if scan.Result.DocumentNumber != "" {
+		byNumber, err := o.aml.SearchByIDNumberContext(ctx, scan.Result.DocumentNumber, country, dob)
+		if err != nil {
+			return scan, byNumber, err
+		}
+		mergeAMLResponse(&screening, byNumber)
+	}
+
+	return scan, screening, warning
+}
+
+// PRIVATE
+
+// Append the items of from not already in into, keeping the higher MatchScore of any duplicates
+// RawResponse is left empty, since the combined response wasn't returned by the API as-is
+func mergeAMLResponse(into *AMLResponse, from AMLResponse) {
+	seen := map[string]int{}
+	for i, item := range into.Items {
+		key, _ := json.Marshal(item)
+		seen[string(key)] = i
+	}
+
+	for _, item := range from.Items {
+		key, _ := json.Marshal(item)
+		if i, ok := seen[string(key)]; ok {
+			if item.MatchScore > into.Items[i].MatchScore {
+				into.Items[i].MatchScore = item.MatchScore
+			}
+			continue
+		}
+		seen[string(key)] = len(into.Items)
+		into.Items = append(into.Items, item)
+	}
+
+	into.Total += from.Total
+	into.Truncated = into.Truncated || from.Truncated
+}
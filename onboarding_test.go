@@ -0,0 +1,117 @@
+package idanalyzer_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/danhunsaker/idanalyzer-go-sdk"
+	"github.com/danhunsaker/idanalyzer-go-sdk/idanalyzertest"
+)
+
+func newTestOnboarding(t *testing.T, scan, aml http.Handler, policy idanalyzer.CheckDigitPolicy) *idanalyzer.Onboarding {
+	t.Helper()
+
+	server := idanalyzertest.NewServer(map[string]http.Handler{
+		idanalyzertest.PathCore: scan,
+		idanalyzertest.PathAML:  aml,
+	})
+	t.Cleanup(server.Close)
+
+	core, err := idanalyzer.NewCoreAPI("key", "", server.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := core.SetCheckDigitPolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+	amlAPI, err := idanalyzer.NewAMLAPI("key", "", server.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	onboarding, err := idanalyzer.NewOnboarding(&core, &amlAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return onboarding
+}
+
+var amlSuccess = idanalyzertest.JSON(idanalyzertest.AMLSuccess())
+
+// Answer AML searches with AMLSuccess, keeping each decoded request body in payloads
+func captureAMLPayloads(payloads *[]map[string]interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		*payloads = append(*payloads, payload)
+		amlSuccess.ServeHTTP(w, r)
+	})
+}
+
+func TestVerifyAndScreenWithoutNameOrNumber(t *testing.T) {
+	onboarding := newTestOnboarding(t, rawJSON(`{"result":{"documentSide":"FRONT"}}`), amlSuccess, idanalyzer.PolicyIgnore)
+
+	if _, _, err := onboarding.VerifyAndScreen(context.Background(), testDocumentURL); err == nil {
+		t.Error("expected an error when there is nothing to screen")
+	}
+}
+
+func TestVerifyAndScreenCheckDigitWarning(t *testing.T) {
+	body := `{"result":{"fullName":"JANE SAMPLE"},"verification":{"passed":false,"result":{"checkdigit":false}}}`
+
+	onboarding := newTestOnboarding(t, rawJSON(body), amlSuccess, idanalyzer.PolicyWarn)
+	_, screening, err := onboarding.VerifyAndScreen(context.Background(), testDocumentURL)
+	var checkDigitError *idanalyzer.CheckDigitError
+	if !errors.As(err, &checkDigitError) || checkDigitError.Fatal {
+		t.Errorf("expected a non-fatal check digit warning, got %v", err)
+	}
+	if len(screening.Items) != 1 {
+		t.Errorf("expected screening to run, got %d items", len(screening.Items))
+	}
+
+	onboarding = newTestOnboarding(t, rawJSON(body), amlSuccess, idanalyzer.PolicyReject)
+	if _, screening, err = onboarding.VerifyAndScreen(context.Background(), testDocumentURL); !errors.As(err, &checkDigitError) || !checkDigitError.Fatal {
+		t.Errorf("expected a fatal check digit error, got %v", err)
+	}
+	if len(screening.Items) != 0 {
+		t.Errorf("expected screening to be skipped, got %d items", len(screening.Items))
+	}
+}
+
+func TestVerifyAndScreenSkipsFailedVerification(t *testing.T) {
+	body := `{"result":{"fullName":"JANE SAMPLE"},"verification":{"passed":false,"result":{"checkdigit":true,"notexpired":false}}}`
+	var payloads []map[string]interface{}
+
+	onboarding := newTestOnboarding(t, rawJSON(body), captureAMLPayloads(&payloads), idanalyzer.PolicyIgnore)
+	if _, _, err := onboarding.VerifyAndScreen(context.Background(), testDocumentURL); !errors.Is(err, idanalyzer.ErrScreeningSkipped) {
+		t.Errorf("expected ErrScreeningSkipped, got %v", err)
+	}
+	if len(payloads) != 0 {
+		t.Errorf("expected no AML requests, got %d", len(payloads))
+	}
+}
+
+func TestVerifyAndScreenSearchesScannedDetails(t *testing.T) {
+	var payloads []map[string]interface{}
+
+	onboarding := newTestOnboarding(t, idanalyzertest.JSON(idanalyzertest.CoreSuccess()), captureAMLPayloads(&payloads), idanalyzer.PolicyIgnore)
+	if _, _, err := onboarding.VerifyAndScreen(context.Background(), testDocumentURL); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(payloads) != 2 {
+		t.Fatalf("expected a name search and a document number search, got %d AML requests", len(payloads))
+	}
+	if payloads[0]["name"] != "JANE SAMPLE" || payloads[1]["documentnumber"] != "D1234567" {
+		t.Errorf("expected the scanned name and document number to be searched, got %v and %v", payloads[0], payloads[1])
+	}
+	for _, payload := range payloads {
+		if payload["dob"] != "1990-01-02" || payload["country"] != "US" {
+			t.Errorf("expected the scanned DOB and nationality to narrow the search, got %v", payload)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package idanalyzer_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/danhunsaker/idanalyzer-go-sdk"
+	"github.com/danhunsaker/idanalyzer-go-sdk/idanalyzertest"
+)
+
+func TestResponsesRoundTrip(t *testing.T) {
+	fixtures := map[string]interface{}{
+		"CoreSuccess":               idanalyzertest.CoreSuccess(),
+		"DocuPassIdentitySuccess":   idanalyzertest.DocuPassIdentitySuccess(),
+		"DocuPassSignatureSuccess":  idanalyzertest.DocuPassSignatureSuccess(),
+		"DocuPassValidationSuccess": idanalyzertest.DocuPassValidationSuccess(),
+		"VaultItemSuccess":          idanalyzertest.VaultItemSuccess(),
+		"VaultListSuccess":          idanalyzertest.VaultListSuccess(),
+		"VaultSuccess":              idanalyzertest.VaultSuccess(),
+		"AMLSuccess":                idanalyzertest.AMLSuccess(),
+		"AMLMultipleDatabases":      idanalyzertest.AMLMultipleDatabases(),
+		"ErrInvalidAPIKey":          idanalyzertest.ErrInvalidAPIKey(),
+		"ErrOutOfQuota":             idanalyzertest.ErrOutOfQuota(),
+		"ErrDocumentNotRecognized":  idanalyzertest.ErrDocumentNotRecognized(),
+		"ErrCountryRestricted":      idanalyzertest.ErrCountryRestricted(),
+		"ErrStateRestricted":        idanalyzertest.ErrStateRestricted(),
+		"ErrTypeRestricted":         idanalyzertest.ErrTypeRestricted(),
+		"ErrDualSideMismatch":       idanalyzertest.ErrDualSideMismatch(),
+		"ErrInvalidPhoneNumber":     idanalyzertest.ErrInvalidPhoneNumber(),
+	}
+
+	for name, fixture := range fixtures {
+		t.Run(name, func(t *testing.T) {
+			body, err := json.Marshal(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decoded := reflect.New(reflect.TypeOf(fixture))
+			if err := json.Unmarshal(body, decoded.Interface()); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded.Elem().Interface(), fixture) {
+				t.Errorf("round trip changed the response:\n got %+v\nwant %+v", decoded.Elem().Interface(), fixture)
+			}
+		})
+	}
+}
+
+func TestFixturesAreFresh(t *testing.T) {
+	core := idanalyzertest.CoreSuccess()
+	core.Result.FirstName = "CHANGED"
+	item := idanalyzertest.VaultItemSuccess()
+	item.Data.FirstName = "CHANGED"
+	aml := idanalyzertest.AMLSuccess()
+	aml.Items[0].FullName[0] = "CHANGED"
+
+	if idanalyzertest.CoreSuccess().Result.FirstName != "JANE" || idanalyzertest.VaultItemSuccess().Data.FirstName != "JANE" ||
+		idanalyzertest.VaultListSuccess().Items[0].FirstName != "JANE" || idanalyzertest.AMLSuccess().Items[0].FullName[0] != "JANE SAMPLE" {
+		t.Error("expected changes to one fixture value not to leak into the next")
+	}
+}
+
+func TestStrictDecoding(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body http.Handler
+		want []string
+	}{
+		{"modelled core response", idanalyzertest.PathCore, idanalyzertest.JSON(idanalyzertest.CoreSuccess()), nil},
+		{"new fields", idanalyzertest.PathCore, rawJSON(`{"result":{"documentNumber":"X","newField":1},"newTop":true}`), []string{"newTop", "result.newField"}},
+		{"AML error", idanalyzertest.PathAML, idanalyzertest.Error(idanalyzertest.ErrCountryRestricted()), nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var fields []string
+			var mutex sync.Mutex
+			report := idanalyzer.WithStrictDecoding(func(err error) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				fields = append(fields, err.(*idanalyzer.UnknownFieldError).Field)
+			})
+
+			server := idanalyzertest.NewServer(map[string]http.Handler{test.path: test.body})
+			t.Cleanup(server.Close)
+
+			if test.path == idanalyzertest.PathAML {
+				aml, err := idanalyzer.NewAMLAPI("key", "", server.Option(), report)
+				if err != nil {
+					t.Fatal(err)
+				}
+				aml.SearchByName("Jane Sample", "", "")
+			} else {
+				core, err := idanalyzer.NewCoreAPI("key", "", server.Option(), report)
+				if err != nil {
+					t.Fatal(err)
+				}
+				core.ScanFront(testDocumentURL)
+			}
+
+			if !reflect.DeepEqual(fields, test.want) {
+				t.Errorf("expected unknown fields %q, got %q", test.want, fields)
+			}
+		})
+	}
+}
+
+func TestMalformedResponsesAreErrors(t *testing.T) {
+	malformed := rawJSON(`<html>502 Bad Gateway</html>`)
+	server := idanalyzertest.NewServer(map[string]http.Handler{
+		idanalyzertest.PathCore:             malformed,
+		idanalyzertest.PathDocuPassCreate:   malformed,
+		idanalyzertest.PathDocuPassValidate: malformed,
+		idanalyzertest.PathVaultGet:         malformed,
+		idanalyzertest.PathAML:              malformed,
+	})
+	t.Cleanup(server.Close)
+
+	core, err := idanalyzer.NewCoreAPI("key", "", server.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+	docuPass, err := idanalyzer.NewDocuPassAPI("key", "Company", "", server.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault, err := idanalyzer.NewVaultAPI("key", "", server.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+	aml, err := idanalyzer.NewAMLAPI("key", "", server.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := map[string]func() error{
+		"Core": func() error {
+			_, err := core.ScanFront(testDocumentURL)
+			return err
+		},
+		"DocuPass create": func() error {
+			_, err := docuPass.CreateIFrame()
+			return err
+		},
+		"DocuPass validate": func() error {
+			_, err := docuPass.Validate("ABC", "0123")
+			return err
+		},
+		"Vault": func() error {
+			_, err := vault.Get("1")
+			return err
+		},
+		"AML": func() error {
+			_, err := aml.SearchByName("JANE SAMPLE", "", "")
+			return err
+		},
+	}
+
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			err := call()
+			if err == nil || !strings.Contains(err.Error(), "failed to parse API response") || !strings.Contains(err.Error(), "502 Bad Gateway") {
+				t.Errorf("expected a parse error quoting the body, got %v", err)
+			}
+		})
+	}
+}
@@ -2,17 +2,22 @@ package idanalyzer
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
+	"image"
+	"image/jpeg"
 	"net/http"
-	"net/url"
+	"reflect"
+	"strings"
+	"time"
 )
 
 type VaultAPI struct {
-	apiKey      string
-	apiEndpoint string
+	apiClient
+	strictInput        bool
+	allowFullOverwrite bool
 }
 
 type VaultItemRequest struct {
@@ -28,9 +33,10 @@ type VaultListRequest struct {
 }
 
 type VaultItemResponse struct {
-	Error   *APIError  `json:"error"`
-	Success bool       `json:"success"`
-	Data    *VaultData `json:"data"`
+	Error     *APIError  `json:"error"`
+	Success   bool       `json:"success"`
+	Data      *VaultData `json:"data"`
+	RequestID string     `json:"-"` // Request ID from the API server's response headers, for support tickets; empty if the server sent none
 }
 
 type VaultListResponse struct {
@@ -40,22 +46,31 @@ type VaultListResponse struct {
 	NextOffset uint        `json:"nextoffset"`
 	Total      uint        `json:"total"`
 	Items      []VaultData `json:"items"`
+	RequestID  string      `json:"-"` // Request ID from the API server's response headers, for support tickets; empty if the server sent none
 }
 
 type VaultSuccessResponse struct {
-	Success uint      `json:"success"`
-	Error   *APIError `json:"error"`
+	Success   uint      `json:"success"`
+	Error     *APIError `json:"error"`
+	RequestID string    `json:"-"` // Request ID from the API server's response headers, for support tickets; empty if the server sent none
 }
 
 type VaultImageResponse struct {
-	Success uint            `json:"success"`
-	Error   *APIError       `json:"error"`
-	Image   *VaultImageData `json:"image"`
+	Success   uint            `json:"success"`
+	Error     *APIError       `json:"error"`
+	Image     *VaultImageData `json:"image"`
+	RequestID string          `json:"-"` // Request ID from the API server's response headers, for support tickets; empty if the server sent none
 }
 
+// Most entries a single face search can return; maxEntry values above it are capped
+// The API has no offset for face search, so matches beyond the first VaultFaceSearchMaxEntries can't be fetched, and
+// a response with that many items may be incomplete; raise the threshold to narrow the search instead
+const VaultFaceSearchMaxEntries = 10
+
 type VaultFaceSearchResponse struct {
-	Error *APIError   `json:"error"`
-	Items []VaultData `json:"items"`
+	Error     *APIError   `json:"error"`
+	Items     []VaultData `json:"items"`
+	RequestID string      `json:"-"` // Request ID from the API server's response headers, for support tickets; empty if the server sent none
 }
 
 type VaultData struct {
@@ -116,6 +131,79 @@ type VaultData struct {
 	Image                   []VaultImageData `json:"image"`
 }
 
+// Builds filter statements for List, ListAll and DeleteAll, chaining up to 5 conditions that must all match
+// Field names are the JSON keys of VaultData (e.g. "createtime", "docupass_reference", "customdata1")
+//
+//	filter, err := NewVaultFilter().GreaterThan("createtime", "2021/01/01").Contains("fullName", "Smith").Build()
+type VaultFilter struct {
+	statements []string
+	err        error
+}
+
+func NewVaultFilter() *VaultFilter {
+	return &VaultFilter{}
+}
+
+// Match entries where field equals value
+func (f *VaultFilter) Equals(field, value string) *VaultFilter {
+	return f.add(field, "=", value)
+}
+
+// Match entries where field does not equal value
+func (f *VaultFilter) NotEquals(field, value string) *VaultFilter {
+	return f.add(field, "!=", value)
+}
+
+// Match entries where field contains value anywhere
+func (f *VaultFilter) Contains(field, value string) *VaultFilter {
+	return f.add(field, " LIKE ", "%"+value+"%")
+}
+
+// Match entries where field is greater than value, e.g. a date in YYYY/MM/DD format
+func (f *VaultFilter) GreaterThan(field, value string) *VaultFilter {
+	return f.add(field, ">", value)
+}
+
+// Match entries where field is greater than or equal to value
+func (f *VaultFilter) GreaterOrEqual(field, value string) *VaultFilter {
+	return f.add(field, ">=", value)
+}
+
+// Match entries where field is less than value
+func (f *VaultFilter) LessThan(field, value string) *VaultFilter {
+	return f.add(field, "<", value)
+}
+
+// Match entries where field is less than or equal to value
+func (f *VaultFilter) LessOrEqual(field, value string) *VaultFilter {
+	return f.add(field, "<=", value)
+}
+
+// Return the filter statements, or the first error from an unknown field or too many conditions
+func (f *VaultFilter) Build() ([]string, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	return append([]string(nil), f.statements...), nil
+}
+
+func (f *VaultFilter) add(field, operator, value string) *VaultFilter {
+	if f.err != nil {
+		return f
+	}
+
+	if !vaultFilterFields[field] {
+		f.err = fmt.Errorf("unknown vault filter field %q", field)
+	} else if len(f.statements) >= 5 {
+		f.err = errors.New("filter should be an array containing maximum of 5 filter statements")
+	} else {
+		f.statements = append(f.statements, field+operator+value)
+	}
+
+	return f
+}
+
 type VaultImageData struct {
 	ID         string `json:"id"`
 	Type       string `json:"type"`
@@ -124,45 +212,159 @@ type VaultImageData struct {
 	CreateTime string `json:"createtime"`
 }
 
+// Walks the results of ListAll; call Next until it returns false, then check Err
+//
+//	for it.Next() {
+//		entry := it.Item()
+//	}
+//	if err := it.Err(); err != nil {
+type VaultIterator struct {
+	vault   *VaultAPI
+	ctx     context.Context
+	request VaultListRequest
+	items   []VaultData
+	item    VaultData
+	done    bool
+	err     error
+}
+
+// Advance to the next entry, fetching the next page when needed; returns false when done or on error
+func (it *VaultIterator) Next() bool {
+	for len(it.items) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		it.fetch()
+	}
+
+	it.item, it.items = it.items[0], it.items[1:]
+	return true
+}
+
+// The current entry, valid after Next returns true
+func (it *VaultIterator) Item() VaultData {
+	return it.item
+}
+
+// The first error encountered while fetching pages, if any
+func (it *VaultIterator) Err() error {
+	return it.err
+}
+
+func (it *VaultIterator) fetch() {
+	if it.err = it.ctx.Err(); it.err != nil {
+		return
+	}
+
+	var list VaultListResponse
+	if it.err = it.vault.callAPI(it.ctx, "list", it.request, &list); it.err != nil {
+		return
+	}
+
+	it.items = list.Items
+	if list.NextOffset > it.request.Offset {
+		it.request.Offset = list.NextOffset
+	} else {
+		it.request.Offset += uint(len(list.Items))
+	}
+	it.done = len(list.Items) == 0 || it.request.Offset >= list.Total
+}
+
+// Face training status values reported by TrainingStatus
+const (
+	VaultTrainingNotStarted = "notstarted"
+	VaultTrainingRunning    = "running"
+	VaultTrainingSucceeded  = "succeeded"
+	VaultTrainingFailed     = "failed"
+)
+
 type VaultTrainingStatusResponse struct {
 	Status           string    `json:"status"`
 	StartTime        string    `json:"startTime"`
 	StatusChangeTime string    `json:"statusChangeTime"`
 	LastSuccessTime  string    `json:"lastSuccessTime"`
 	Error            *APIError `json:"error"`
+	RequestID        string    `json:"-"` // Request ID from the API server's response headers, for support tickets; empty if the server sent none
 }
 
 // Initialize Vault API with an API key and region (US (default), EU)
-func NewVaultAPI(apiKey, region string) (VaultAPI, error) {
+func NewVaultAPI(apiKey, region string, opts ...ClientOption) (VaultAPI, error) {
 	if apiKey == "" {
 		return VaultAPI{}, errors.New("please provide an API key")
 	}
 
-	return VaultAPI{
-		apiKey:      apiKey,
-		apiEndpoint: endpointFromRegion(region, "vault"),
-	}, nil
+	client, err := newAPIClient(apiKey, region, "vault")
+	if err != nil {
+		return VaultAPI{}, err
+	}
+
+	v := VaultAPI{
+		apiClient: client,
+	}
+
+	for _, opt := range opts {
+		if err := opt(&v.apiClient); err != nil {
+			return VaultAPI{}, err
+		}
+	}
+
+	return v, nil
+}
+
+// SETTERS
+
+// Set a default timeout for API requests, applied whenever the request context has no deadline of its own
+// Set to 0 to disable the default timeout
+func (v *VaultAPI) SetTimeout(timeout time.Duration) {
+	v.timeout = timeout
+}
+
+// Send requests to endpoint verbatim, instead of the endpoint chosen by region, e.g. a mock server or on-premise deployment
+// Only http and https URLs are accepted, and any trailing slash is removed
+func (v *VaultAPI) SetEndpoint(endpoint string) error {
+	return v.setEndpoint(endpoint)
+}
+
+// Refuse image arguments that could be interpreted as either a URL or a local file, instead of silently treating them as URLs
+func (v *VaultAPI) EnableStrictInput(enabled bool) {
+	v.strictInput = enabled
+}
+
+// Allow Update to send a VaultData with nothing but its ID set, blanking every other field of the entry
+// Such updates are refused by default, as they're almost always a programming error
+func (v *VaultAPI) AllowFullOverwrite(allow bool) {
+	v.allowFullOverwrite = allow
 }
 
 // ACTIONS
 
 // Get a single vault entry
 func (v *VaultAPI) Get(vault_id string) (response VaultItemResponse, err error) {
+	return v.GetContext(context.Background(), vault_id)
+}
+
+// Get a single vault entry, bounded by ctx
+func (v *VaultAPI) GetContext(ctx context.Context, vault_id string) (response VaultItemResponse, err error) {
 	if vault_id == "" {
 		return VaultItemResponse{}, errors.New("vault entry ID required")
 	}
 
-	err = v.callAPI("get", VaultItemRequest{ID: vault_id}, &response)
+	err = v.callAPI(ctx, "get", VaultItemRequest{ID: vault_id}, &response)
 	return
 }
 
 // List multiple vault entries with optional filter, sorting and paging arguments
 func (v *VaultAPI) List(filter []string, orderby, sort string, limit, offset uint) (response VaultListResponse, err error) {
+	return v.ListContext(context.Background(), filter, orderby, sort, limit, offset)
+}
+
+// List multiple vault entries with optional filter, sorting and paging arguments, bounded by ctx
+func (v *VaultAPI) ListContext(ctx context.Context, filter []string, orderby, sort string, limit, offset uint) (response VaultListResponse, err error) {
 	if len(filter) > 5 {
 		return VaultListResponse{}, errors.New("filter should be an array containing maximum of 5 filter statements")
 	}
 
-	err = v.callAPI("list", VaultListRequest{
+	err = v.callAPI(ctx, "list", VaultListRequest{
 		Filter:  filter,
 		OrderBy: orderby,
 		Sort:    sort,
@@ -172,54 +374,230 @@ func (v *VaultAPI) List(filter []string, orderby, sort string, limit, offset uin
 	return
 }
 
+// Iterate over every vault entry matching filter, fetching pages lazily as the iterator advances
+func (v *VaultAPI) ListAll(filter []string, orderby, sort string) (*VaultIterator, error) {
+	return v.ListAllContext(context.Background(), filter, orderby, sort)
+}
+
+// Iterate over every vault entry matching filter, stopping with ctx.Err() once the context is cancelled
+func (v *VaultAPI) ListAllContext(ctx context.Context, filter []string, orderby, sort string) (*VaultIterator, error) {
+	if len(filter) > 5 {
+		return nil, errors.New("filter should be an array containing maximum of 5 filter statements")
+	}
+
+	return &VaultIterator{
+		vault: v,
+		ctx:   ctx,
+		request: VaultListRequest{
+			Filter:  filter,
+			OrderBy: orderby,
+			Sort:    sort,
+			Limit:   vaultListPageSize,
+		},
+	}, nil
+}
+
 // Update vault entry with new data
+// Every field of data is sent, so fields left empty overwrite the stored values with blanks; use UpdateFields to change only some fields
 func (v *VaultAPI) Update(data VaultData) (response VaultSuccessResponse, err error) {
+	return v.UpdateContext(context.Background(), data)
+}
+
+// Update vault entry with new data, bounded by ctx
+func (v *VaultAPI) UpdateContext(ctx context.Context, data VaultData) (response VaultSuccessResponse, err error) {
 	if data.ID == "" {
 		return VaultSuccessResponse{}, errors.New("vault entry ID required")
 	}
+	if !v.allowFullOverwrite && reflect.DeepEqual(data, VaultData{ID: data.ID}) {
+		return VaultSuccessResponse{}, errors.New("refusing to overwrite vault entry with empty data; see AllowFullOverwrite")
+	}
+
+	err = v.callAPI(ctx, "update", data, &response)
+	return
+}
+
+// Update only the given fields of a vault entry, leaving every other field as stored
+// Field names are the JSON keys of VaultData, e.g. "customdata1"; "id" is taken from vault_id
+func (v *VaultAPI) UpdateFields(vault_id string, fields map[string]interface{}) (response VaultSuccessResponse, err error) {
+	return v.UpdateFieldsContext(context.Background(), vault_id, fields)
+}
+
+// Update only the given fields of a vault entry, bounded by ctx
+func (v *VaultAPI) UpdateFieldsContext(ctx context.Context, vault_id string, fields map[string]interface{}) (response VaultSuccessResponse, err error) {
+	if vault_id == "" {
+		return VaultSuccessResponse{}, errors.New("vault entry ID required")
+	}
+	if len(fields) == 0 {
+		return VaultSuccessResponse{}, errors.New("fields to update required")
+	}
+
+	payload := map[string]interface{}{"id": vault_id}
+	for field, value := range fields {
+		if field == "id" || !vaultFilterFields[field] {
+			return VaultSuccessResponse{}, fmt.Errorf("unknown vault field %q", field)
+		}
+		payload[field] = value
+	}
 
-	err = v.callAPI("update", data, &response)
+	err = v.callAPI(ctx, "update", payload, &response)
 	return
 }
 
-// Delete a single or multiple vault entries
+// Delete a single vault entry; use DeleteMany to delete several in one request
 func (v *VaultAPI) Delete(vault_id string) (response VaultSuccessResponse, err error) {
+	return v.DeleteContext(context.Background(), vault_id)
+}
+
+// Delete a single vault entry, bounded by ctx
+func (v *VaultAPI) DeleteContext(ctx context.Context, vault_id string) (response VaultSuccessResponse, err error) {
 	if vault_id == "" {
 		return VaultSuccessResponse{}, errors.New("vault entry ID required")
 	}
 
-	err = v.callAPI("delete", VaultItemRequest{ID: vault_id}, &response)
+	err = v.callAPI(ctx, "delete", VaultItemRequest{ID: vault_id}, &response)
 	return
 }
 
+// Delete multiple vault entries in one request, ignoring duplicate IDs
+func (v *VaultAPI) DeleteMany(ids []string) (response VaultSuccessResponse, err error) {
+	return v.DeleteManyContext(context.Background(), ids)
+}
+
+// Delete multiple vault entries in one request, bounded by ctx
+func (v *VaultAPI) DeleteManyContext(ctx context.Context, ids []string) (response VaultSuccessResponse, err error) {
+	if len(ids) == 0 {
+		return VaultSuccessResponse{}, errors.New("vault entry IDs required")
+	}
+
+	seen := map[string]bool{}
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" {
+			return VaultSuccessResponse{}, errors.New("vault entry ID required")
+		}
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	return v.deleteMany(ctx, unique)
+}
+
+// Delete every vault entry matching filter in batches, calling onProgress (if not nil) after each batch
+// Deleted entries no longer match the filter, so calling DeleteAll again with the same filter resumes an interrupted run
+// The context is checked between batches; an empty filter is refused rather than wiping the entire vault
+// A batch that makes no progress (the same entries listed again, or the total not dropping) stops the run with an error
+func (v *VaultAPI) DeleteAll(ctx context.Context, filter []string, onProgress func(deleted, total uint)) error {
+	if len(filter) == 0 {
+		return errors.New("filter required; refusing to delete every vault entry")
+	}
+	if len(filter) > 5 {
+		return errors.New("filter should be an array containing maximum of 5 filter statements")
+	}
+
+	var deleted, total, lastTotal uint
+	var lastIDs string
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var list VaultListResponse
+		if err := v.callAPI(ctx, "list", VaultListRequest{Filter: filter, Limit: vaultDeleteBatchSize}, &list); err != nil {
+			return err
+		}
+		if total == 0 {
+			total = list.Total
+		}
+		if len(list.Items) == 0 {
+			return nil
+		}
+
+		ids := make([]string, 0, len(list.Items))
+		for _, item := range list.Items {
+			ids = append(ids, item.ID)
+		}
+		if deleted > 0 && (strings.Join(ids, ",") == lastIDs || (lastTotal > 0 && list.Total >= lastTotal)) {
+			return fmt.Errorf("vault entries still listed after deletion; stopped after %d of %d", deleted, total)
+		}
+		lastIDs, lastTotal = strings.Join(ids, ","), list.Total
+
+		response, err := v.deleteMany(ctx, ids)
+		if err != nil {
+			return err
+		}
+		if response.Success == 0 {
+			return fmt.Errorf("failed to delete vault entries after %d of %d", deleted, total)
+		}
+
+		deleted += uint(len(ids))
+		if onProgress != nil {
+			onProgress(deleted, total)
+		}
+	}
+}
+
 // Add a document or face image into an existing vault entry
 func (v *VaultAPI) AddImage(vault_id, image string, image_type uint) (response VaultImageResponse, err error) {
+	return v.AddImageContext(context.Background(), vault_id, image, image_type)
+}
+
+// Add a document or face image into an existing vault entry, bounded by ctx
+func (v *VaultAPI) AddImageContext(ctx context.Context, vault_id, image string, image_type uint) (response VaultImageResponse, err error) {
+	if v.strictInput {
+		if err := checkAmbiguousImage(image); err != nil {
+			return VaultImageResponse{}, err
+		}
+	}
+
+	input, ok := DetectImageInput(image)
+	if !ok {
+		return VaultImageResponse{}, errors.New("invalid image, file not found, or malformed URL")
+	}
+
+	return v.AddImageInputContext(ctx, vault_id, input, image_type)
+}
+
+// Add a document or face image, given explicitly rather than detected from a string, into an existing vault entry
+func (v *VaultAPI) AddImageInput(vault_id string, image ImageInput, image_type uint) (response VaultImageResponse, err error) {
+	return v.AddImageInputContext(context.Background(), vault_id, image, image_type)
+}
+
+// Add a document or face image, given explicitly rather than detected from a string, into an existing vault entry, bounded by ctx
+func (v *VaultAPI) AddImageInputContext(ctx context.Context, vault_id string, image ImageInput, image_type uint) (response VaultImageResponse, err error) {
 	if vault_id == "" {
 		return VaultImageResponse{}, errors.New("vault entry ID required")
 	}
 	if image_type != 0 && image_type != 1 {
 		return VaultImageResponse{}, errors.New("invalid image type, 0 or 1 accepted")
 	}
+	if image == nil {
+		return VaultImageResponse{}, errors.New("image required")
+	}
 
 	payload := map[string]interface{}{"id": vault_id, "type": image_type}
 
-	if _, err := url.ParseRequestURI(image); err == nil {
-		payload["imageurl"] = image
-	} else if fileExists(image) {
-		payload["image"] = base64File(image)
-	} else if len(image) > 100 {
-		payload["image"] = image
+	if imageURL, content, err := image.resolve(0); err != nil {
+		return VaultImageResponse{}, fmt.Errorf("invalid image: %s", err.Error())
+	} else if imageURL != "" {
+		payload["imageurl"] = imageURL
 	} else {
-		return VaultImageResponse{}, errors.New("invalid image, file not found, or malformed URL")
+		payload["image"] = content
 	}
 
-	err = v.callAPI("addimage", payload, &response)
+	err = v.callAPI(ctx, "addimage", payload, &response)
 	return
-
 }
 
 // Delete an image from vault
 func (v *VaultAPI) DeleteImage(vault_id, image_id string) (response VaultSuccessResponse, err error) {
+	return v.DeleteImageContext(context.Background(), vault_id, image_id)
+}
+
+// Delete an image from vault, bounded by ctx
+func (v *VaultAPI) DeleteImageContext(ctx context.Context, vault_id, image_id string) (response VaultSuccessResponse, err error) {
 	if vault_id == "" {
 		return VaultSuccessResponse{}, errors.New("vault entry ID required")
 	}
@@ -227,59 +605,232 @@ func (v *VaultAPI) DeleteImage(vault_id, image_id string) (response VaultSuccess
 		return VaultSuccessResponse{}, errors.New("image ID required")
 	}
 
-	err = v.callAPI("deleteimage", map[string]interface{}{"id": vault_id, "imageid": image_id}, &response)
+	err = v.callAPI(ctx, "deleteimage", map[string]interface{}{"id": vault_id, "imageid": image_id}, &response)
 	return
 }
 
+// Download a stored vault image through the configured HTTP client, returning its bytes and content type
+// Images larger than the 32MB cropped image limit are refused rather than read into memory
+// Image URLs can expire; if the URL is refused, Get the vault entry again for fresh image URLs
+func (v *VaultAPI) GetImageBytes(ctx context.Context, img VaultImageData) ([]byte, string, error) {
+	if !isRemoteURL(img.URL) {
+		return nil, "", errors.New("vault image has no URL")
+	}
+
+	ctx, cancel := withDefaultTimeout(ctx, v.timeout)
+	defer cancel()
+
+	response, err := v.doRequest(ctx, http.MethodGet, img.URL, "", nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to connect to image server: %s", err.Error())
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusGone:
+		return nil, "", fmt.Errorf("vault image URL expired or not accessible (%s); Get the entry again for a fresh URL", response.Status)
+	}
+
+	data, err := readLimited(response, maxOutputImageSize)
+	if err != nil {
+		return nil, "", err
+	}
+
+	contentType := response.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+
+	return data, contentType, nil
+}
+
 // Search vault using a person's face image
+// At most VaultFaceSearchMaxEntries matches are returned, whatever maxEntry is, and there is no way to page past them
 func (v *VaultAPI) SearchFace(image string, maxEntry uint, threshold float32) (response VaultFaceSearchResponse, err error) {
+	return v.SearchFaceContext(context.Background(), image, maxEntry, threshold)
+}
+
+// Search vault using a person's face image, bounded by ctx
+func (v *VaultAPI) SearchFaceContext(ctx context.Context, image string, maxEntry uint, threshold float32) (response VaultFaceSearchResponse, err error) {
+	if v.strictInput {
+		if err := checkAmbiguousImage(image); err != nil {
+			return VaultFaceSearchResponse{}, err
+		}
+	}
+
+	input, ok := DetectImageInput(image)
+	if !ok {
+		return VaultFaceSearchResponse{}, errors.New("invalid image, file not found or malformed URL")
+	}
+
+	return v.SearchFaceInputContext(ctx, input, maxEntry, threshold)
+}
+
+// Search vault using a person's face image, given explicitly rather than detected from a string
+// threshold must be greater than 0 and at most 1, and maxEntry at least 1; maxEntry above VaultFaceSearchMaxEntries is capped
+func (v *VaultAPI) SearchFaceInput(image ImageInput, maxEntry uint, threshold float32) (response VaultFaceSearchResponse, err error) {
+	return v.SearchFaceInputContext(context.Background(), image, maxEntry, threshold)
+}
+
+// Search vault using a person's face image, given explicitly rather than detected from a string, bounded by ctx
+func (v *VaultAPI) SearchFaceInputContext(ctx context.Context, image ImageInput, maxEntry uint, threshold float32) (response VaultFaceSearchResponse, err error) {
+	if image == nil {
+		return VaultFaceSearchResponse{}, errors.New("image required")
+	}
+	if err := validateFaceSearch(maxEntry, threshold); err != nil {
+		return VaultFaceSearchResponse{}, err
+	}
+	if maxEntry > VaultFaceSearchMaxEntries {
+		maxEntry = VaultFaceSearchMaxEntries
+	}
+
 	payload := map[string]interface{}{"maxentry": maxEntry, "threshold": threshold}
 
-	if _, err := url.ParseRequestURI(image); err == nil {
-		payload["imageurl"] = image
-	} else if fileExists(image) {
-		payload["image"] = base64File(image)
-	} else if len(image) > 100 {
-		payload["image"] = image
+	if imageURL, content, err := image.resolve(0); err != nil {
+		return VaultFaceSearchResponse{}, fmt.Errorf("invalid image: %s", err.Error())
+	} else if imageURL != "" {
+		payload["imageurl"] = imageURL
 	} else {
-		return VaultFaceSearchResponse{}, errors.New("invalid image, file not found or malformed URL")
+		payload["image"] = content
 	}
 
-	err = v.callAPI("searchface", payload, &response)
+	err = v.callAPI(ctx, "searchface", payload, &response)
 	return
 }
 
+// Search vault using a decoded face image, which is JPEG-encoded before it is sent
+// threshold must be greater than 0 and at most 1, and maxEntry at least 1
+func (v *VaultAPI) SearchFaceImage(img image.Image, maxEntry uint, threshold float32) (response VaultFaceSearchResponse, err error) {
+	return v.SearchFaceImageContext(context.Background(), img, maxEntry, threshold)
+}
+
+// Search vault using a decoded face image, bounded by ctx
+func (v *VaultAPI) SearchFaceImageContext(ctx context.Context, img image.Image, maxEntry uint, threshold float32) (response VaultFaceSearchResponse, err error) {
+	if img == nil {
+		return VaultFaceSearchResponse{}, errors.New("image required")
+	}
+	if err := validateFaceSearch(maxEntry, threshold); err != nil {
+		return VaultFaceSearchResponse{}, err
+	}
+
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 90}); err != nil {
+		return VaultFaceSearchResponse{}, fmt.Errorf("failed to encode image: %s", err.Error())
+	}
+
+	return v.SearchFaceInputContext(ctx, BytesInput(encoded.Bytes()), maxEntry, threshold)
+}
+
 // Train vault for face search
 func (v *VaultAPI) TrainFace() (response VaultSuccessResponse, err error) {
-	err = v.callAPI("train", []string{}, &response)
+	return v.TrainFaceContext(context.Background())
+}
+
+// Train vault for face search, bounded by ctx
+func (v *VaultAPI) TrainFaceContext(ctx context.Context) (response VaultSuccessResponse, err error) {
+	err = v.callAPI(ctx, "train", map[string]interface{}{}, &response)
 	return
 }
 
-// Get vault training status
+// Get vault training status; Status is one of the VaultTraining* values
 func (v *VaultAPI) TrainingStatus() (response VaultTrainingStatusResponse, err error) {
-	err = v.callAPI("trainstatus", []string{}, &response)
+	return v.TrainingStatusContext(context.Background())
+}
+
+// Get vault training status, bounded by ctx
+func (v *VaultAPI) TrainingStatusContext(ctx context.Context) (response VaultTrainingStatusResponse, err error) {
+	err = v.callAPI(ctx, "trainstatus", map[string]interface{}{}, &response)
 	return
 }
 
+// Poll TrainingStatus every pollInterval until training succeeds or fails, or ctx is done
+// A failed training is not an error: check Status on the returned response to branch on the outcome
+// Training that was never started reports "notstarted" and is polled until ctx is done, so call TrainFace first
+func (v *VaultAPI) WaitForTraining(ctx context.Context, pollInterval time.Duration) (response VaultTrainingStatusResponse, err error) {
+	if pollInterval <= 0 {
+		return VaultTrainingStatusResponse{}, errors.New("poll interval must be greater than 0")
+	}
+
+	for {
+		response = VaultTrainingStatusResponse{}
+		if err = v.callAPI(ctx, "trainstatus", map[string]interface{}{}, &response); err != nil {
+			return
+		}
+		if response.Status == VaultTrainingSucceeded || response.Status == VaultTrainingFailed {
+			return response, nil
+		}
+
+		timer := time.NewTimer(pollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return response, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
 // PRIVATE
 
-func (v *VaultAPI) callAPI(action string, request, result interface{}) error {
-	var payload map[string]interface{}
+// JSON keys of VaultData that can be used in a VaultFilter
+var vaultFilterFields = func() map[string]bool {
+	fields := map[string]bool{}
+
+	dataType := reflect.TypeOf(VaultData{})
+	for i := 0; i < dataType.NumField(); i++ {
+		if name := dataType.Field(i).Tag.Get("json"); name != "" && name != "image" {
+			fields[name] = true
+		}
+	}
+
+	return fields
+}()
+
+func validateFaceSearch(maxEntry uint, threshold float32) error {
+	if threshold <= 0 || threshold > 1 {
+		return errors.New("invalid threshold value; float32 between 0 to 1 accepted")
+	}
+	if maxEntry < 1 {
+		return errors.New("invalid maximum entries; must be at least 1")
+	}
+
+	return nil
+}
+
+const vaultDeleteBatchSize = 100
+const vaultListPageSize = 100
+
+func (v *VaultAPI) deleteMany(ctx context.Context, ids []string) (response VaultSuccessResponse, err error) {
+	err = v.callAPI(ctx, "delete", map[string]interface{}{"id": ids}, &response)
+	return
+}
+
+func (v *VaultAPI) callAPI(ctx context.Context, action string, request, result interface{}) error {
+	payload := map[string]interface{}{}
 
 	temp, _ := json.Marshal(request)
-	json.Unmarshal(temp, &payload)
+	if err := json.Unmarshal(temp, &payload); err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
 
 	payload["apikey"] = v.apiKey
-	payload["client"] = "go-sdk"
+	payload["client"] = v.client()
 
-	body, _ := json.Marshal(payload)
+	ctx, cancel := withDefaultTimeout(ctx, v.timeout)
+	defer cancel()
 
-	if response, err := http.Post(fmt.Sprintf("%s/%s", v.apiEndpoint, action), "application/json", bytes.NewBuffer(body)); err != nil {
-		return fmt.Errorf("failed to connect to API server: %s", err.Error())
-	} else {
-		body, _ := io.ReadAll(response.Body)
-		json.Unmarshal(body, &result)
+	raw, err := v.doJSON(ctx, fmt.Sprintf("%s/%s", v.apiEndpoint, action), payload, result)
+	if err != nil {
+		return err
+	}
 
-		return nil
+	// Every Vault response carries an optional error; the parsed response is still returned alongside it
+	var response struct {
+		Error *APIError `json:"error"`
 	}
+	if json.Unmarshal(raw, &response) == nil && response.Error != nil && response.Error.Message != "" {
+		return response.Error
+	}
+
+	return nil
 }
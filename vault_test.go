@@ -0,0 +1,85 @@
+package idanalyzer_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/danhunsaker/idanalyzer-go-sdk"
+	"github.com/danhunsaker/idanalyzer-go-sdk/idanalyzertest"
+)
+
+func newTestVault(t *testing.T, handlers map[string]http.Handler) idanalyzer.VaultAPI {
+	t.Helper()
+
+	server := idanalyzertest.NewServer(handlers)
+	t.Cleanup(server.Close)
+
+	vault, err := idanalyzer.NewVaultAPI("key", "", server.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return vault
+}
+
+func TestDeleteAllStopsWithoutProgress(t *testing.T) {
+	var deletes int
+	vault := newTestVault(t, map[string]http.Handler{
+		idanalyzertest.PathVaultList: idanalyzertest.JSON(idanalyzertest.VaultListSuccess()),
+		idanalyzertest.PathVaultDelete: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			deletes++
+			idanalyzertest.JSON(idanalyzertest.VaultSuccess()).ServeHTTP(w, r)
+		}),
+	})
+
+	err := vault.DeleteAll(context.Background(), []string{"customdata1=test"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "still listed after deletion") {
+		t.Fatalf("expected a no progress error, got %v", err)
+	}
+	if deletes != 1 {
+		t.Errorf("expected one delete before stopping, got %d", deletes)
+	}
+}
+
+func TestGetImageBytesSizeLimit(t *testing.T) {
+	server := idanalyzertest.NewServer(map[string]http.Handler{
+		"/image.jpg": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(make([]byte, 32<<20+1))
+		}),
+	})
+	t.Cleanup(server.Close)
+
+	vault, err := idanalyzer.NewVaultAPI("key", "", server.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = vault.GetImageBytes(context.Background(), idanalyzer.VaultImageData{URL: server.URL + "/image.jpg"})
+	if err == nil || !strings.Contains(err.Error(), "download limit") {
+		t.Errorf("expected a download limit error, got %v", err)
+	}
+}
+
+func TestVaultReturnsAPIError(t *testing.T) {
+	notFound := idanalyzer.APIError{Code: 6, Message: "Vault entry not found"}
+	vault := newTestVault(t, map[string]http.Handler{
+		idanalyzertest.PathVaultGet:  idanalyzertest.Error(notFound),
+		idanalyzertest.PathVaultList: idanalyzertest.Error(notFound),
+	})
+
+	response, err := vault.Get("missing")
+	var apiError *idanalyzer.APIError
+	if !errors.As(err, &apiError) || apiError.Message != notFound.Message {
+		t.Errorf("expected the API error from Get, got %v", err)
+	}
+	if response.Data != nil {
+		t.Errorf("expected no data, got %+v", response.Data)
+	}
+
+	if _, err := vault.List(nil, "", "", 10, 0); !errors.As(err, &apiError) {
+		t.Errorf("expected the API error from List, got %v", err)
+	}
+}